@@ -7,6 +7,8 @@ import (
 
 // After runs the received state after d time.Duration has elapsed.
 // This function blocks until the timer elapses, when it returns the next resolved state.
+//
+// The timer is created using the Clock found in the context.
 func After(d time.Duration, state Fn) Fn {
 	return after(d).run(state)
 }
@@ -24,12 +26,13 @@ func (e after) run(states ...Fn) Fn {
 
 func runAfter(d time.Duration, run Fn) Fn {
 	return func(ctx context.Context) Fn {
-		done := make(chan Fn)
-		time.AfterFunc(d, func() {
-			done <- run(ctx)
+		done := make(chan Fn, 1)
+		t := ClockFrom(ctx).AfterFunc(d, func() {
+			done <- exec(ctx, run)
 		})
 		select {
 		case <-ctx.Done():
+			t.Stop()
 			if err := ctx.Err(); err != nil {
 				return ErrorEnd(err)
 			}
@@ -1,11 +1,14 @@
 package ssm
 
 import (
+	"context"
 	"time"
 )
 
 // At runs the received state at t time.Time.
 // This function blocks until the time is reached, when it returns the next resolved state.
+//
+// The remaining time is computed when the state gets executed, using the Clock found in the context.
 func At(t time.Time, state Fn) Fn {
 	return alarm(t).run(state)
 }
@@ -18,5 +21,7 @@ func (t alarm) run(states ...Fn) Fn {
 		return End
 	}
 
-	return runAfter(time.Time(t).Sub(time.Now()), run)
+	return func(ctx context.Context) Fn {
+		return runAfter(time.Time(t).Sub(ClockFrom(ctx).Now()), run)(ctx)
+	}
 }
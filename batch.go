@@ -14,19 +14,27 @@ func batchExec(states ...Fn) Fn {
 	}
 
 	return func(ctx context.Context) Fn {
-		nextStates := make([]Fn, 0, len(states))
+		return aggStates(batchExec, batchStep(ctx, states)...)
+	}
+}
 
-		for _, state := range states {
-			if IsEnd(state) {
-				continue
-			}
+// batchStep executes each of the received states once, sequentially, and returns
+// the non End states they resolved to.
+func batchStep(ctx context.Context, states []Fn) []Fn {
+	nextStates := make([]Fn, 0, len(states))
+	o := observer(ctx)
+
+	for _, state := range states {
+		if IsEnd(state) {
+			continue
+		}
 
-			st := state(ctx)
+		st := exec(ctx, state)
+		o.OnTransition(state, st)
 
-			if !IsEnd(st) {
-				nextStates = append(nextStates, st)
-			}
+		if !IsEnd(st) {
+			nextStates = append(nextStates, st)
 		}
-		return aggStates(batchExec, nextStates...)
 	}
+	return nextStates
 }
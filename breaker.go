@@ -3,6 +3,7 @@ package ssm
 import (
 	"context"
 	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -10,8 +11,22 @@ import (
 // Breaker is a state machine that can be used for disabling execution of incoming "fn" state if
 // its returning state is an error state and the conditions of the "trip" TripStrategyFn are fulfilled.
 //
-// Currently, there is no method for closing the Breaker once opened.
+// There is no method for closing the Breaker once opened, use CircuitBreaker for that.
 func Breaker(trip TripStrategyFn, fn Fn) Fn {
+	if trip == nil {
+		trip = neverTrip
+	}
+	return BreakerWithStrategy(trip, fn)
+}
+
+// BreakerWithStrategy is a Breaker which uses the "trip" TripStrategy to determine if
+// the error states returned by "fn" require it to open.
+// It allows Breaker to be used with the strategies which keep track of the successful executions
+// too, like ConsecutiveFailuresTrip or FailureRateTrip.
+func BreakerWithStrategy(trip TripStrategy, fn Fn) Fn {
+	if trip == nil {
+		trip = TripStrategyFn(neverTrip)
+	}
 	b := b{
 		tripCheck: trip,
 		fn:        fn,
@@ -21,7 +36,7 @@ func Breaker(trip TripStrategyFn, fn Fn) Fn {
 
 // OpenBreaker is an error state that is used to trip open the Breaker.
 func OpenBreaker() Fn {
-	return errState{errors.New("open breaker")}.stop
+	return errState{error: errors.New("open breaker")}.stop
 }
 
 // TripStrategyFn is used by the Circuit Breaker state machine to determine if current run
@@ -32,6 +47,35 @@ func OpenBreaker() Fn {
 // only for error states.
 type TripStrategyFn func() bool
 
+// Failure calls the TripStrategyFn function, and returns its result.
+func (t TripStrategyFn) Failure(_ context.Context) bool {
+	if t == nil {
+		return false
+	}
+	return t()
+}
+
+// Success does nothing, as a TripStrategyFn is not interested in successful executions.
+func (t TripStrategyFn) Success(_ context.Context) {}
+
+// TripStrategy is used by the Circuit Breaker state machines to determine if current run
+// requires the breaker to trip open.
+//
+// Unlike a TripStrategyFn, it gets notified about the successful executions of the breaker state too,
+// and it receives the context, so it can use the Clock found in it.
+//
+// If the TripStrategy has a Reset() method, the CircuitBreaker calls it every time it closes, before replacing it.
+type TripStrategy interface {
+	// Failure records an execution which returned an error state, and returns if the breaker needs to trip open.
+	Failure(ctx context.Context) bool
+	// Success records an execution which returned a non error state.
+	Success(ctx context.Context)
+}
+
+type resetter interface {
+	Reset()
+}
+
 func neverTrip() bool {
 	return false
 }
@@ -62,9 +106,49 @@ func MaxTriesTrip(max int) TripStrategyFn {
 	return m.check
 }
 
+// SharedMaxTriesTrip is a MaxTriesTrip TripStrategy which counts the failures in the counter of "key"
+// in the "store" CounterStore, so it can be shared by multiple processes.
+//
+// If the store returns an error, the breaker is tripped.
+func SharedMaxTriesTrip(store CounterStore, key string, max int) TripStrategy {
+	return &sharedTries{store: store, key: key, max: int64(max)}
+}
+
+type sharedTries struct {
+	store CounterStore
+	key   string
+	max   int64
+}
+
+func (s *sharedTries) Failure(ctx context.Context) bool {
+	if s.max < 0 {
+		return false
+	}
+	n, err := s.store.Incr(ctx, s.key, 1, 0)
+	return err != nil || n >= s.max
+}
+
+func (s *sharedTries) Success(_ context.Context) {}
+
+// Reset sets the counter back to 0, unless another process has modified it in the meantime.
+func (s *sharedTries) Reset() {
+	ctx := context.Background()
+	if n, err := s.store.Get(ctx, s.key); err == nil {
+		_, _ = s.store.CompareAndSet(ctx, s.key, n, 0, 0)
+	}
+}
+
 // TimedTrip uses "fn" TripStrategyFn for returning the status of the Breaker, but it resets it
 // every "d" time.Duration.
+//
+// As a TripStrategyFn does not have access to the context, TimedTrip measures time using the SystemClock.
+// Use TimedTripWithClock for a different Clock.
 func TimedTrip(d time.Duration, fn TripStrategyFn) TripStrategyFn {
+	return TimedTripWithClock(SystemClock, d, fn)
+}
+
+// TimedTripWithClock is the same as TimedTrip, but it measures time using the "c" Clock.
+func TimedTripWithClock(c Clock, d time.Duration, fn TripStrategyFn) TripStrategyFn {
 	if fn == nil {
 		// Run at least once
 		return MaxTriesTrip(1)
@@ -73,10 +157,10 @@ func TimedTrip(d time.Duration, fn TripStrategyFn) TripStrategyFn {
 	t := &fn
 	// When the timer expires, it means that the passed trip strategy has not opened the breaker, so we reset
 	// both the timer and the trip strategy.
-	timer := time.NewTimer(d)
+	timer := c.NewTimer(d)
 	return func() bool {
 		select {
-		case <-timer.C:
+		case <-timer.C():
 			fn = *t
 			timer.Reset(d)
 		default:
@@ -85,15 +169,314 @@ func TimedTrip(d time.Duration, fn TripStrategyFn) TripStrategyFn {
 	}
 }
 
+// ConsecutiveFailuresTrip returns a TripStrategy which trips the breaker after "n" consecutive failures.
+// Every successful execution resets the count, so sporadic failures never trip the breaker.
+//
+// The check functions can be run safely in parallel.
+func ConsecutiveFailuresTrip(n int) TripStrategy {
+	if n < 1 {
+		n = 1
+	}
+	return &cf{max: int32(n)}
+}
+
+type cf struct {
+	max      int32
+	failures atomic.Int32
+}
+
+func (c *cf) Failure(_ context.Context) bool {
+	return c.failures.Add(1) >= c.max
+}
+
+func (c *cf) Success(_ context.Context) {
+	c.failures.Store(0)
+}
+
+func (c *cf) Reset() {
+	c.failures.Store(0)
+}
+
+// FailureRateTrip returns a TripStrategy which trips the breaker when the ratio of failed executions
+// in the last "window" time.Duration reaches "ratio", as long as there were at least "minRequests"
+// executions in that window.
+//
+// The executions are tracked in a rolling window made of buckets, and the time is measured using the
+// Clock found in the context. The strategy can be used safely in parallel.
+func FailureRateTrip(window time.Duration, minRequests int, ratio float64) TripStrategy {
+	width := window / failureRateBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return &failureRate{
+		window:      window,
+		width:       width,
+		minRequests: minRequests,
+		ratio:       ratio,
+	}
+}
+
+const failureRateBuckets = 10
+
+type rateBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+type failureRate struct {
+	m sync.Mutex
+
+	window      time.Duration
+	width       time.Duration
+	minRequests int
+	ratio       float64
+	buckets     [failureRateBuckets]rateBucket
+}
+
+func (f *failureRate) Failure(ctx context.Context) bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	now := ClockFrom(ctx).Now()
+	f.bucket(now).failures++
+
+	total, failures := f.count(now)
+	if total == 0 || total < f.minRequests {
+		return false
+	}
+	return float64(failures)/float64(total) >= f.ratio
+}
+
+func (f *failureRate) Success(ctx context.Context) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.bucket(ClockFrom(ctx).Now()).successes++
+}
+
+func (f *failureRate) Reset() {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.buckets = [failureRateBuckets]rateBucket{}
+}
+
+// bucket returns the bucket corresponding to "now", clearing it if it contains stale executions.
+func (f *failureRate) bucket(now time.Time) *rateBucket {
+	start := now.Truncate(f.width)
+	b := &f.buckets[(start.UnixNano()/int64(f.width))%failureRateBuckets]
+	if !b.start.Equal(start) {
+		*b = rateBucket{start: start}
+	}
+	return b
+}
+
+// count returns the number of total and failed executions in the window ending at "now".
+func (f *failureRate) count(now time.Time) (int, int) {
+	total, failures := 0, 0
+	for _, b := range f.buckets {
+		if b.start.IsZero() || now.Sub(b.start) >= f.window {
+			continue
+		}
+		total += b.successes + b.failures
+		failures += b.failures
+	}
+	return total, failures
+}
+
 type b struct {
-	tripCheck func() bool
+	tripCheck TripStrategy
 	fn        Fn
 }
 
 func (b b) check(ctx context.Context) Fn {
 	next := b.fn(ctx)
-	if IsError(next) && b.tripCheck() {
+	if !IsError(next) {
+		b.tripCheck.Success(ctx)
+		return b.check
+	}
+	if b.tripCheck.Failure(ctx) {
 		return OpenBreaker()
 	}
 	return b.check
 }
+
+// BreakerOptions configures the transitions of a CircuitBreaker.
+type BreakerOptions struct {
+	// CoolDown is the time.Duration the breaker stays open, before allowing probe executions.
+	CoolDown time.Duration
+	// HalfOpenProbes is the maximum number of concurrent executions allowed while the breaker is half-open.
+	// It defaults to 1.
+	HalfOpenProbes int
+	// SuccessThreshold is the number of successful probe executions required for closing the breaker.
+	// It defaults to 1.
+	SuccessThreshold int
+	// Fallback, if set, is the state executed instead of the breaker's state while the breaker is open.
+	Fallback Fn
+}
+
+// BreakerWithFallback is a CircuitBreaker which, while open, routes the execution to the "fallback" state
+// instead of ending the state machine with the OpenBreaker error state. This allows "fallback" to provide
+// a degraded mode of operation, like serving cached data.
+//
+// The "fallback" state also gets executed right after "fn" fails and opens the breaker.
+// There is no cool-down, so every subsequent execution probes "fn" again, and once it succeeds
+// the breaker closes and the execution returns to "fn".
+// For other cool-down or probing configurations use CircuitBreaker with BreakerOptions.Fallback.
+func BreakerWithFallback(trip func() TripStrategy, fn, fallback Fn) Fn {
+	return CircuitBreaker(trip, BreakerOptions{Fallback: fallback}, fn)
+}
+
+// CircuitBreaker is a Breaker which can be closed again after being opened.
+//
+// While closed, it executes the "fn" state and uses a TripStrategy created by the "trip" factory to determine if
+// an error state requires it to open. Every time the breaker closes, the factory gets called again,
+// so the strategies which count the failures, like MaxTriesTrip, start over with their original budget.
+// When it opens, and while it is open, it returns the OpenBreaker error state, or executes the Fallback
+// state if one is set, without executing "fn". After the CoolDown passes,
+// the breaker becomes half-open, and it allows up to HalfOpenProbes concurrent executions of "fn".
+// If SuccessThreshold of them are successful the breaker closes, and if any of them fails, it opens again.
+//
+// The time is measured using the Clock found in the context. The returned state can be shared by
+// multiple state machines, which will see the same breaker status.
+func CircuitBreaker(trip func() TripStrategy, opts BreakerOptions, fn Fn) Fn {
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 1
+	}
+	if opts.SuccessThreshold <= 0 {
+		opts.SuccessThreshold = 1
+	}
+	c := cb{
+		newTrip: trip,
+		opts:    opts,
+		fn:      fn,
+	}
+	c.tripCheck = c.trip()
+	return c.check
+}
+
+type breakerStatus int8
+
+const (
+	breakerClosed breakerStatus = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type cb struct {
+	m sync.Mutex
+
+	newTrip   func() TripStrategy
+	tripCheck TripStrategy
+	opts      BreakerOptions
+	fn        Fn
+
+	status    breakerStatus
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+// trip returns a new TripStrategy, created by the "newTrip" factory.
+func (c *cb) trip() TripStrategy {
+	if c.newTrip != nil {
+		if trip := c.newTrip(); trip != nil {
+			return trip
+		}
+	}
+	return TripStrategyFn(neverTrip)
+}
+
+func (c *cb) check(ctx context.Context) Fn {
+	clock := ClockFrom(ctx)
+
+	allowed, probe := c.acquire(clock.Now())
+	if !allowed {
+		return c.fallback(ctx)
+	}
+	next := c.fn(ctx)
+	if c.release(ctx, clock.Now(), probe, IsError(next)) {
+		return c.fallback(ctx)
+	}
+	return c.check
+}
+
+// fallback executes the Fallback state, if one is set, and returns to the breaker.
+// If the Fallback state fails, its error state is returned.
+func (c *cb) fallback(ctx context.Context) Fn {
+	if IsEnd(c.opts.Fallback) {
+		return OpenBreaker()
+	}
+	if next := c.opts.Fallback(ctx); IsError(next) {
+		return next
+	}
+	return c.check
+}
+
+// acquire returns if the execution of the state is allowed, and if it is a half-open probe.
+func (c *cb) acquire(now time.Time) (bool, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.status == breakerOpen {
+		if now.Sub(c.openedAt) < c.opts.CoolDown {
+			return false, false
+		}
+		c.status = breakerHalfOpen
+		c.probes = 0
+		c.successes = 0
+	}
+	if c.status == breakerHalfOpen {
+		if c.probes >= c.opts.HalfOpenProbes {
+			return false, false
+		}
+		c.probes++
+		return true, true
+	}
+	return true, false
+}
+
+// release records the outcome of an execution and returns if the breaker is open as a result of it.
+func (c *cb) release(ctx context.Context, now time.Time, probe, failed bool) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if probe {
+		c.probes--
+		if c.status != breakerHalfOpen {
+			// NOTE(marius): another probe already resolved the half-open status.
+			return c.status == breakerOpen
+		}
+		if failed {
+			c.open(now)
+			return true
+		}
+		if c.successes++; c.successes >= c.opts.SuccessThreshold {
+			c.status = breakerClosed
+			if r, ok := c.tripCheck.(resetter); ok {
+				r.Reset()
+			}
+			c.tripCheck = c.trip()
+		}
+		return false
+	}
+
+	if c.status != breakerClosed {
+		return c.status == breakerOpen
+	}
+	if !failed {
+		c.tripCheck.Success(ctx)
+		return false
+	}
+	if c.tripCheck.Failure(ctx) {
+		c.open(now)
+		return true
+	}
+	return false
+}
+
+func (c *cb) open(now time.Time) {
+	c.status = breakerOpen
+	c.openedAt = now
+}
@@ -1,6 +1,8 @@
 package ssm
 
 import (
+	"context"
+	"errors"
 	"math"
 	"testing"
 	"time"
@@ -124,3 +126,299 @@ func TestTimedTrip(t *testing.T) {
 		})
 	}
 }
+
+func mockOutcomes(outcomes ...bool) (Fn, *int) {
+	cnt := 0
+	return func(_ context.Context) Fn {
+		defer func() { cnt++ }()
+		if cnt < len(outcomes) && !outcomes[cnt] {
+			return ErrorEnd(errors.New("fail"))
+		}
+		return End
+	}, &cnt
+}
+
+func maxTries(max int) func() TripStrategy {
+	return func() TripStrategy {
+		return MaxTriesTrip(max)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	type step struct {
+		advance  time.Duration
+		wantOpen bool
+		wantExec bool
+	}
+	tests := []struct {
+		name     string
+		trip     func() TripStrategy
+		opts     BreakerOptions
+		outcomes []bool
+		steps    []step
+	}{
+		{
+			name:     "never trips",
+			outcomes: []bool{true, false, true},
+			steps: []step{
+				{wantExec: true},
+				{wantExec: true},
+				{wantExec: true},
+			},
+		},
+		{
+			name:     "opens and closes after cool down",
+			trip:     maxTries(1),
+			opts:     BreakerOptions{CoolDown: time.Second},
+			outcomes: []bool{false, true, true},
+			steps: []step{
+				{wantExec: true, wantOpen: true},
+				{advance: 500 * time.Millisecond, wantOpen: true},
+				{advance: 500 * time.Millisecond, wantExec: true},
+				{wantExec: true},
+			},
+		},
+		{
+			name:     "reopens on failed probe",
+			trip:     maxTries(1),
+			opts:     BreakerOptions{CoolDown: time.Second},
+			outcomes: []bool{false, false, true},
+			steps: []step{
+				{wantExec: true, wantOpen: true},
+				{advance: time.Second, wantExec: true, wantOpen: true},
+				{wantOpen: true},
+				{advance: time.Second, wantExec: true},
+			},
+		},
+		{
+			name:     "closes after success threshold",
+			trip:     maxTries(1),
+			opts:     BreakerOptions{CoolDown: time.Second, SuccessThreshold: 2},
+			outcomes: []bool{false, true, true, false},
+			steps: []step{
+				{wantExec: true, wantOpen: true},
+				{advance: time.Second, wantExec: true},
+				{wantExec: true},
+				{wantExec: true, wantOpen: true},
+			},
+		},
+		{
+			name:     "closing restores the trip budget",
+			trip:     maxTries(2),
+			opts:     BreakerOptions{CoolDown: time.Second},
+			outcomes: []bool{false, false, true, false, false},
+			steps: []step{
+				{wantExec: true},
+				{wantExec: true, wantOpen: true},
+				{advance: time.Second, wantExec: true},
+				// NOTE(marius): the breaker has closed, so MaxTriesTrip allows two failures again.
+				{wantExec: true},
+				{wantExec: true, wantOpen: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			ctx := WithClock(context.Background(), clock)
+
+			fn, cnt := mockOutcomes(tt.outcomes...)
+			brk := CircuitBreaker(tt.trip, tt.opts, fn)
+			for i, st := range tt.steps {
+				clock.advance(st.advance)
+
+				before := *cnt
+				next := brk(ctx)
+				if executed := *cnt > before; executed != st.wantExec {
+					t.Errorf("CircuitBreaker() step %d executed = %t, want %t", i, executed, st.wantExec)
+				}
+				if open := IsError(next); open != st.wantOpen {
+					t.Errorf("CircuitBreaker() step %d open = %t, want %t", i, open, st.wantOpen)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerWithFallback(t *testing.T) {
+	fn, cnt := mockOutcomes(false, false, true, true)
+
+	fallbacks := 0
+	fallback := func(_ context.Context) Fn {
+		fallbacks++
+		return End
+	}
+
+	brk := BreakerWithFallback(maxTries(1), fn, fallback)
+	for i := 0; i < 5; i++ {
+		if next := brk(context.Background()); !sameFns(next, brk) {
+			t.Errorf("BreakerWithFallback() step %d = %s, want the breaker state", i, nameOf(next))
+		}
+	}
+	// NOTE(marius): the first failure trips the breaker and the second one is a failed probe,
+	// both are followed by the fallback, after that the probe succeeds and the breaker closes.
+	if *cnt != 5 {
+		t.Errorf("BreakerWithFallback() executed state %d times, want %d", *cnt, 5)
+	}
+	if fallbacks != 2 {
+		t.Errorf("BreakerWithFallback() executed fallback %d times, want %d", fallbacks, 2)
+	}
+}
+
+func TestCircuitBreakerFallbackDuringCoolDown(t *testing.T) {
+	clock := newTestClock()
+	ctx := WithClock(context.Background(), clock)
+
+	fn, cnt := mockOutcomes(false)
+	fallbacks := 0
+	fallback := func(_ context.Context) Fn {
+		fallbacks++
+		return End
+	}
+
+	brk := CircuitBreaker(maxTries(1), BreakerOptions{CoolDown: time.Second, Fallback: fallback}, fn)
+	for i := 0; i < 3; i++ {
+		brk(ctx)
+	}
+	if *cnt != 1 || fallbacks != 3 {
+		t.Errorf("CircuitBreaker() executed state %d and fallback %d times, want 1 and 3", *cnt, fallbacks)
+	}
+
+	clock.advance(time.Second)
+	brk(ctx)
+	if *cnt != 2 || fallbacks != 3 {
+		t.Errorf("CircuitBreaker() executed state %d and fallback %d times, want 2 and 3", *cnt, fallbacks)
+	}
+}
+
+func TestFailureRateTrip(t *testing.T) {
+	type call struct {
+		advance time.Duration
+		failed  bool
+		want    bool
+	}
+	tests := []struct {
+		name        string
+		window      time.Duration
+		minRequests int
+		ratio       float64
+		calls       []call
+	}{
+		{
+			name:        "below min requests",
+			window:      time.Second,
+			minRequests: 3,
+			ratio:       0.5,
+			calls: []call{
+				{failed: true, want: false},
+				{failed: true, want: false},
+				{failed: true, want: true},
+			},
+		},
+		{
+			name:        "below ratio",
+			window:      time.Second,
+			minRequests: 1,
+			ratio:       0.5,
+			calls: []call{
+				{failed: false},
+				{failed: false},
+				{failed: true, want: false},
+				{failed: true, want: true},
+			},
+		},
+		{
+			name:        "failures leave the window",
+			window:      time.Second,
+			minRequests: 2,
+			ratio:       0.5,
+			calls: []call{
+				{failed: true, want: false},
+				{advance: time.Second, failed: true, want: false},
+				{advance: 100 * time.Millisecond, failed: true, want: true},
+			},
+		},
+		{
+			name:        "successes leave the window",
+			window:      time.Second,
+			minRequests: 1,
+			ratio:       0.5,
+			calls: []call{
+				{failed: false},
+				{failed: false},
+				{advance: 500 * time.Millisecond, failed: true, want: false},
+				{advance: 600 * time.Millisecond, failed: true, want: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			ctx := WithClock(context.Background(), clock)
+
+			trip := FailureRateTrip(tt.window, tt.minRequests, tt.ratio)
+			for i, c := range tt.calls {
+				clock.advance(c.advance)
+				if !c.failed {
+					trip.Success(ctx)
+					continue
+				}
+				if got := trip.Failure(ctx); got != c.want {
+					t.Errorf("FailureRateTrip() call %d = %t, want %t", i, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerReportsSuccess(t *testing.T) {
+	clock := newTestClock()
+	ctx := WithClock(context.Background(), clock)
+
+	fn, _ := mockOutcomes(true, true, false, false)
+	brk := BreakerWithStrategy(FailureRateTrip(time.Second, 4, 0.5), fn)
+	for i, wantOpen := range []bool{false, false, false, true} {
+		if next := brk(ctx); IsError(next) != wantOpen {
+			t.Errorf("BreakerWithStrategy() step %d open = %t, want %t", i, IsError(next), wantOpen)
+		}
+	}
+}
+
+func TestConsecutiveFailuresTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		outcomes []bool
+		want     []bool
+	}{
+		{
+			name:     "zero trips on first failure",
+			n:        0,
+			outcomes: []bool{true, false},
+			want:     []bool{false, true},
+		},
+		{
+			name:     "three consecutive",
+			n:        3,
+			outcomes: []bool{false, false, false},
+			want:     []bool{false, false, true},
+		},
+		{
+			name:     "reset by success",
+			n:        3,
+			outcomes: []bool{false, false, true, false, false, true, false, false, false},
+			want:     []bool{false, false, false, false, false, false, false, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, _ := mockOutcomes(tt.outcomes...)
+			brk := BreakerWithStrategy(ConsecutiveFailuresTrip(tt.n), fn)
+			for i, want := range tt.want {
+				if next := brk(context.Background()); IsError(next) != want {
+					t.Errorf("BreakerWithStrategy(ConsecutiveFailuresTrip()) step %d open = %t, want %t", i, IsError(next), want)
+				}
+			}
+		})
+	}
+}
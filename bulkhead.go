@@ -0,0 +1,83 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// Bulkhead is a state machine which executes the "fn" state, and its following states, in
+// at most "maxConcurrent" goroutines at the same time.
+//
+// When all the slots are taken, up to "maxQueue" executions wait for one to become available,
+// and any further execution fails with the BulkheadFull error state.
+//
+// The limits are kept by the returned state, so it can be shared by separately started
+// state machines, or by the branches of a Parallel one.
+func Bulkhead(maxConcurrent, maxQueue int, fn Fn) Fn {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	b := bulkhead{
+		slots:    make(chan struct{}, maxConcurrent),
+		queued:   &atomic.Int32{},
+		maxQueue: int32(maxQueue),
+	}
+	return b.run(fn)
+}
+
+// BulkheadFull is the error returned by a Bulkhead state when both its slots and its queue are taken.
+var BulkheadFull = errors.New("bulkhead is full")
+
+type bulkhead struct {
+	slots    chan struct{}
+	queued   *atomic.Int32
+	maxQueue int32
+}
+
+func (b bulkhead) run(fn Fn) Fn {
+	if IsEnd(fn) || IsError(fn) {
+		return fn
+	}
+	return func(ctx context.Context) Fn {
+		if err := b.acquire(ctx); err != nil {
+			return ErrorEnd(err)
+		}
+		next := b.exec(ctx, fn)
+		return b.run(next)
+	}
+}
+
+func (b bulkhead) exec(ctx context.Context, fn Fn) Fn {
+	defer b.release()
+	return exec(ctx, fn)
+}
+
+// acquire takes one of the slots, waiting in the queue if none is available.
+func (b bulkhead) acquire(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if b.queued.Add(1) > b.maxQueue {
+		b.queued.Add(-1)
+		return BulkheadFull
+	}
+	defer b.queued.Add(-1)
+
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func (b bulkhead) release() {
+	<-b.slots
+}
@@ -0,0 +1,148 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockConcurrency returns a state which waits on "release" and records the maximum number
+// of its concurrent executions in "max".
+func mockConcurrency(cur, max *atomic.Int32, release <-chan struct{}) Fn {
+	return func(_ context.Context) Fn {
+		n := cur.Add(1)
+		for m := max.Load(); n > m && !max.CompareAndSwap(m, n); m = max.Load() {
+		}
+		<-release
+		cur.Add(-1)
+		return End
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		maxQueue      int
+		executions    int
+		wantMax       int32
+		wantFull      int
+	}{
+		{
+			name:          "invalid limits",
+			maxConcurrent: 0,
+			maxQueue:      -1,
+			executions:    3,
+			wantMax:       1,
+			wantFull:      2,
+		},
+		{
+			name:          "all queued",
+			maxConcurrent: 2,
+			maxQueue:      3,
+			executions:    5,
+			wantMax:       2,
+			wantFull:      0,
+		},
+		{
+			name:          "queue overflows",
+			maxConcurrent: 2,
+			maxQueue:      1,
+			executions:    5,
+			wantMax:       2,
+			wantFull:      2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur, max := atomic.Int32{}, atomic.Int32{}
+			release := make(chan struct{})
+			fn := Bulkhead(tt.maxConcurrent, tt.maxQueue, mockConcurrency(&cur, &max, release))
+
+			errs := make(chan error, tt.executions)
+			wg := sync.WaitGroup{}
+			for i := 0; i < tt.executions; i++ {
+				wg.Add(1)
+				// NOTE(marius): every execution is a separately started machine sharing the Bulkhead.
+				go func() {
+					defer wg.Done()
+					errs <- Run(context.Background(), fn)
+				}()
+			}
+
+			full := 0
+			for i := 0; i < tt.wantFull; i++ {
+				if err := <-errs; errors.Is(err, BulkheadFull) {
+					full++
+				} else {
+					t.Errorf("Run() error = %v, wanted %v", err, BulkheadFull)
+				}
+			}
+			for cur.Load() < tt.wantMax {
+				time.Sleep(time.Millisecond)
+			}
+			close(release)
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if errors.Is(err, BulkheadFull) {
+					full++
+				} else if err != nil {
+					t.Errorf("Run() error = %v", err)
+				}
+			}
+
+			if full != tt.wantFull {
+				t.Errorf("Bulkhead() rejected %d executions, wanted %d", full, tt.wantFull)
+			}
+			if got := max.Load(); got != tt.wantMax {
+				t.Errorf("Bulkhead() ran %d concurrent executions, wanted %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestBulkhead_nextStates(t *testing.T) {
+	cur, max := atomic.Int32{}, atomic.Int32{}
+	release := make(chan struct{})
+	close(release)
+
+	steps := atomic.Int32{}
+	var fn Fn
+	fn = func(ctx context.Context) Fn {
+		if steps.Add(1) > 3 {
+			return End
+		}
+		mockConcurrency(&cur, &max, release)(ctx)
+		return fn
+	}
+
+	bh := Bulkhead(1, 10, fn)
+	if err := RunParallel(context.Background(), bh, bh, bh); err != nil {
+		t.Errorf("RunParallel() error = %v", err)
+	}
+	if got := max.Load(); got != 1 {
+		t.Errorf("Bulkhead() ran %d concurrent executions, wanted %d", got, 1)
+	}
+}
+
+func TestBulkhead_canceled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	cur, max := atomic.Int32{}, atomic.Int32{}
+	fn := Bulkhead(1, 1, mockConcurrency(&cur, &max, release))
+	go Run(context.Background(), fn)
+	for cur.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Run(ctx, fn); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, wanted %v", err, context.DeadlineExceeded)
+	}
+}
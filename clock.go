@@ -0,0 +1,107 @@
+package ssm
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time used by the time based state machines: After, At, BackOff, Timeout,
+// RateLimit and the Breaker.
+//
+// The Clock is loaded from the context by the states when they get executed, and it can be set
+// using WithClock. When none is found, the system clock is used.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc waits for the duration to elapse and then calls f in its own goroutine.
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTimer creates a new Timer that will send the current time on its channel after at least duration d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the equivalent of a time.Timer for a Clock.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	// For timers created with AfterFunc it returns nil.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing.
+	Stop() bool
+	// Reset changes the timer to expire after duration d.
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is the Clock which uses the functions from the time package.
+var SystemClock Clock = sysClock{}
+
+const __clock smKeys = "__clock"
+
+// WithClock returns a copy of "ctx" context.Context which carries the "c" Clock.
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, __clock, c)
+}
+
+// ClockFrom retrieves the Clock from ctx context.Context.
+// If nothing is found it returns the SystemClock.
+func ClockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(__clock).(Clock); ok && c != nil {
+		return c
+	}
+	return SystemClock
+}
+
+const __deadline smKeys = "__deadline"
+
+// withTimeout is the equivalent of context.WithTimeout, but using the Clock found in "ctx".
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	c := ClockFrom(ctx)
+	if _, ok := c.(sysClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+
+	deadline := c.Now().Add(d)
+	if cur, ok := deadlineOf(ctx); ok && cur.Before(deadline) {
+		deadline = cur
+	}
+	ctx, cancel := context.WithCancelCause(context.WithValue(ctx, __deadline, deadline))
+	t := c.AfterFunc(d, func() {
+		cancel(context.DeadlineExceeded)
+	})
+	return ctx, func() {
+		t.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+// deadlineOf is the equivalent of ctx.Deadline(), but it returns the deadline measured by the Clock found in "ctx".
+//
+// NOTE(marius): the deadlines of the contexts created with context.WithTimeout or context.WithDeadline are
+// measured by the system clock, so they are ignored when "ctx" uses a different Clock.
+func deadlineOf(ctx context.Context) (time.Time, bool) {
+	if _, ok := ClockFrom(ctx).(sysClock); ok {
+		return ctx.Deadline()
+	}
+	deadline, ok := ctx.Value(__deadline).(time.Time)
+	return deadline, ok
+}
+
+type sysClock struct{}
+
+func (sysClock) Now() time.Time {
+	return time.Now()
+}
+
+func (sysClock) AfterFunc(d time.Duration, f func()) Timer {
+	return sysTimer{time.AfterFunc(d, f)}
+}
+
+func (sysClock) NewTimer(d time.Duration) Timer {
+	return sysTimer{time.NewTimer(d)}
+}
+
+type sysTimer struct {
+	*time.Timer
+}
+
+func (t sysTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -0,0 +1,60 @@
+package ssm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a Clock whose Now time only changes when advance is called.
+// Its timers use the SystemClock.
+type testClock struct {
+	sysClock
+
+	m   sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestClockFrom(t *testing.T) {
+	tc := newTestClock()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want Clock
+	}{
+		{
+			name: "empty",
+			ctx:  context.Background(),
+			want: SystemClock,
+		},
+		{
+			name: "with clock",
+			ctx:  WithClock(context.Background(), tc),
+			want: tc,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClockFrom(tt.ctx); got != tt.want {
+				t.Errorf("ClockFrom() = %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	ssmIf     = ssmName + ".If"
+	ssmSwitch = ssmName + ".Switch"
+	ssmWhile  = ssmName + ".While"
+	ssmRepeat = ssmName + ".Repeat"
+)
+
+func isControlFlow(call *ast.CallExpr) bool {
+	switch getFuncNameFromExpr(call.Fun) {
+	case ssmIf, ssmSwitch, ssmWhile, ssmRepeat:
+		return true
+	}
+	return false
+}
+
+// loadControlFlow returns the node corresponding to a call of one of the If, Switch, While and Repeat
+// states, which is connected to each of its branches with a label describing when it gets executed.
+//
+// The node is named after the function, its predicate, key or count argument, and the position
+// of the call, so that every call gets its own node.
+func (s stateSearch) loadControlFlow(states *[]Connectable, call *ast.CallExpr) (Connectable, bool) {
+	if !isControlFlow(call) || len(call.Args) == 0 {
+		return nil, false
+	}
+	name := getFuncNameFromExpr(call.Fun)
+	node := &StateNode{
+		Name:       name[len(ssmName)+1:] + "(" + argName(call.Args[0]) + ") " + s.position(call.Pos()),
+		Group:      s.packageName(),
+		NextStates: make([]Connectable, 0),
+	}
+	if existing, ok := findState(*states, node.Group, node.Name); ok {
+		return existing, true
+	}
+
+	branches := call.Args[1:]
+	switch name {
+	case ssmIf:
+		s.appendBranches(states, node, branches, "true", "false")
+	case ssmSwitch:
+		if len(branches) > 0 {
+			if cases, ok := branches[0].(*ast.CompositeLit); ok {
+				for _, el := range cases.Elts {
+					if kv, ok := el.(*ast.KeyValueExpr); ok {
+						s.appendBranch(states, node, kv.Value, argName(kv.Key))
+					}
+				}
+			}
+			s.appendBranches(states, node, branches[1:], "default")
+		}
+	case ssmWhile:
+		s.appendBranches(states, node, branches, "while true")
+	case ssmRepeat:
+		s.appendBranches(states, node, branches, argName(call.Args[0])+" times")
+	}
+	return node, true
+}
+
+// appendBranches appends the states of the "args" expressions to the "node", labeled with the corresponding "labels".
+func (s stateSearch) appendBranches(states *[]Connectable, node *StateNode, args []ast.Expr, labels ...string) {
+	for i, arg := range args {
+		if i >= len(labels) {
+			break
+		}
+		s.appendBranch(states, node, arg, labels[i])
+	}
+}
+
+func (s stateSearch) appendBranch(states *[]Connectable, node *StateNode, arg ast.Expr, label string) {
+	if call, ok := arg.(*ast.CallExpr); ok {
+		if st, ok := s.loadControlFlow(states, call); ok {
+			node.AppendLabeled(label, st)
+			appendStates(states, st)
+			return
+		}
+	}
+	if st, ok := findState(*states, s.packageName(), getFuncNameFromExpr(arg)); ok {
+		node.AppendLabeled(label, st)
+	}
+}
+
+// position returns the "file:line:column" representation of "pos", using only the base name of the file.
+func (s stateSearch) position(pos token.Pos) string {
+	if s.fset == nil {
+		return ""
+	}
+	p := s.fset.Position(pos)
+	return fmt.Sprintf("%s:%d:%d", filepath.Base(p.Filename), p.Line, p.Column)
+}
+
+// argName returns a short representation of the "arg" expression, to be used in names and labels.
+func argName(arg ast.Expr) string {
+	switch a := arg.(type) {
+	case *ast.BasicLit:
+		if a.Kind == token.STRING {
+			if v, err := strconv.Unquote(a.Value); err == nil {
+				return v
+			}
+		}
+		return a.Value
+	case *ast.FuncLit:
+		return "func"
+	}
+	if name := getFuncNameFromExpr(arg); name != "" {
+		return name
+	}
+	return "..."
+}
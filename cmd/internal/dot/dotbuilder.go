@@ -74,22 +74,28 @@ func (d *dotBuilder) addStates(states ...internal.Connectable) []*dot.Node {
 		}
 		n1, _ := d.node(state)
 		result = append(result, n1)
-		if len(state.NextStates) > 0 {
-			nodes := d.addStates(state.NextStates...)
-			for _, n2 := range nodes {
-				d.edge(n1, n2)
+		nodes := make([][]*dot.Node, len(state.NextStates))
+		for i, next := range state.NextStates {
+			nodes[i] = d.addStates(next)
+		}
+		for i := range state.NextStates {
+			for _, n2 := range nodes[i] {
+				d.edge(n1, n2, state.Label(i))
 			}
 		}
 	}
 	return result
 }
 
-func (d *dotBuilder) edge(n1, n2 *dot.Node) (*dot.Edge, bool) {
-	edgeKey := n1.ID() + "-" + n2.ID()
+func (d *dotBuilder) edge(n1, n2 *dot.Node, label string) (*dot.Edge, bool) {
+	edgeKey := n1.ID() + "-" + n2.ID() + "-" + label
 	if edge, ok := d.e[edgeKey]; ok {
 		return edge, false
 	}
 	edge := d.g.Edge(*n1, *n2)
+	if label != "" {
+		edge = edge.Label(label)
+	}
 	d.e[edgeKey] = &edge
 	return d.e[edgeKey], true
 }
@@ -29,12 +29,13 @@ var (
 )
 
 type stateSearch struct {
-	p *ast.Package
+	p    *ast.Package
+	fset *token.FileSet
 
 	imports map[string]string
 }
 
-func parseTargetPackages(targets ...string) (map[string]*ast.Package, error) {
+func parseTargetPackages(fset *token.FileSet, targets ...string) (map[string]*ast.Package, error) {
 	errs := make([]error, 0)
 	packages := make(map[string]*ast.Package)
 
@@ -45,7 +46,6 @@ func parseTargetPackages(targets ...string) (map[string]*ast.Package, error) {
 		}
 
 		if fi.IsDir() {
-			fset := token.NewFileSet()
 			pp, err := parser.ParseDir(fset, target, validGoFile, parser.ParseComments)
 			if err != nil {
 				errs = append(errs, err)
@@ -59,7 +59,6 @@ func parseTargetPackages(targets ...string) (map[string]*ast.Package, error) {
 				packages[pn] = p
 			}
 		} else {
-			fset := token.NewFileSet()
 			f, err := parser.ParseFile(fset, target, nil, parser.ParseComments)
 			parent := filepath.Base(filepath.Dir(target))
 			if err != nil {
@@ -106,12 +105,13 @@ func (s stateSearch) findStartStates(states *[]Connectable, packages map[string]
 }
 
 func LoadStates(targets ...string) ([]Connectable, error) {
-	packages, err := parseTargetPackages(targets...)
+	fset := token.NewFileSet()
+	packages, err := parseTargetPackages(fset, targets...)
 	if err != nil {
 		return nil, err
 	}
 
-	s := stateSearch{imports: make(map[string]string)}
+	s := stateSearch{fset: fset, imports: make(map[string]string)}
 
 	// NOTE(marius): we now have all ssm.Fn declared in the target packages.
 	states := s.loadStateNames(packages)
@@ -21,6 +21,9 @@ type StateNode struct {
 	Flags      Flag
 	InStates   []Connectable
 	NextStates []Connectable
+	// Labels contains the labels of the connections to the next states which have one,
+	// by the index of the next state in NextStates.
+	Labels map[int]string
 }
 
 func (s *StateNode) Equals(ss Connectable) bool {
@@ -38,6 +41,20 @@ func (s *StateNode) Append(n ...Connectable) {
 	s.NextStates = append(s.NextStates, n...)
 }
 
+// AppendLabeled appends the "n" next state, with its connection labeled by "label".
+func (s *StateNode) AppendLabeled(label string, n Connectable) {
+	if s.Labels == nil {
+		s.Labels = make(map[int]string)
+	}
+	s.Labels[len(s.NextStates)] = label
+	s.Append(n)
+}
+
+// Label returns the label of the connection to the i-th next state, if it has one.
+func (s *StateNode) Label(i int) string {
+	return s.Labels[i]
+}
+
 func (s *StateNode) Match(group, name string) bool {
 	if group == "" {
 		if s.Name == s.Name {
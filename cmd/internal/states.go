@@ -65,9 +65,19 @@ func (s stateSearch) getParams(states *[]Connectable, res Connectable) func(n as
 		if !ok {
 			return true
 		}
+		if isControlFlow(call) {
+			// NOTE(marius): the control flow states load their branches themselves, when we encounter
+			// them as arguments of their parent call.
+			return false
+		}
 		for _, arg := range call.Args {
 			switch r := arg.(type) {
 			case *ast.CallExpr:
+				if cf, ok := s.loadControlFlow(states, r); ok {
+					res.Append(cf)
+					appendStates(states, cf)
+					continue
+				}
 				// TODO(marius): we need to do this recursively to load all states of form:
 				//   return State1(State2(State3(...)))
 				nm := getFuncNameFromExpr(r.Fun)
@@ -110,6 +120,11 @@ func (s stateSearch) getReturns(states *[]Connectable, res Connectable) func(n a
 		for _, rr := range ret.Results {
 			switch r := rr.(type) {
 			case *ast.CallExpr:
+				if cf, ok := s.loadControlFlow(states, r); ok {
+					res.Append(cf)
+					appendStates(states, cf)
+					continue
+				}
 				// TODO(marius): we need to do this recursively to load all states of form:
 				//   return State1(State2(State3(...)))
 				nm := getFuncNameFromExpr(r.Fun)
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"runtime"
+
+	"git.sr.ht/~mariusor/ssm"
+	"git.sr.ht/~mariusor/ssm/cmd/internal"
+	"git.sr.ht/~mariusor/ssm/cmd/internal/dot"
+)
+
+func ready(ctx context.Context) bool {
+	return ctx.Err() == nil
+}
+
+func kind(_ context.Context) string {
+	return "fast"
+}
+
+func Check(_ context.Context) ssm.Fn {
+	return ssm.If(ready, Dispatch, Done)
+}
+
+func Dispatch(_ context.Context) ssm.Fn {
+	return ssm.Switch(kind, map[string]ssm.Fn{"fast": Fast, "slow": Slow}, Done)
+}
+
+func Fast(_ context.Context) ssm.Fn {
+	return ssm.Repeat(3, Done)
+}
+
+func Slow(_ context.Context) ssm.Fn {
+	return ssm.While(ready, Done)
+}
+
+func Recheck(_ context.Context) ssm.Fn {
+	return ssm.If(ready, Done, Done)
+}
+
+func Done(_ context.Context) ssm.Fn {
+	return nil
+}
+
+func Example_controlFlow() {
+	_, f, _, _ := runtime.Caller(0) // f will be the current file path
+
+	states, _ := internal.LoadStates(f)
+	_ = dot.Dot("", states...)
+	// Output: digraph  {
+	//	subgraph cluster_s1 {
+	//		label="tests";
+	//		n2[label="Check"];
+	//		n4[label="Dispatch"];
+	//		n8[label="Done"];
+	//		n6[label="Fast"];
+	//		n3[label="If(ready) controlflow_test.go:21:9"];
+	//		n12[label="If(ready) controlflow_test.go:37:9"];
+	//		n11[label="Recheck"];
+	//		n7[label="Repeat(3) controlflow_test.go:29:9"];
+	//		n9[label="Slow"];
+	//		n5[label="Switch(kind) controlflow_test.go:25:9"];
+	//		n10[label="While(ready) controlflow_test.go:33:9"];
+	//
+	//	}
+	//
+	//	n2->n3;
+	//	n4->n5;
+	//	n6->n7;
+	//	n3->n4[label="true"];
+	//	n3->n8[label="false"];
+	//	n12->n8[label="true"];
+	//	n12->n8[label="false"];
+	//	n11->n12;
+	//	n7->n8[label="3 times"];
+	//	n9->n10;
+	//	n5->n6[label="fast"];
+	//	n5->n9[label="slow"];
+	//	n5->n8[label="default"];
+	//	n10->n8[label="while true"];
+	//
+	//}
+}
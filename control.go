@@ -0,0 +1,87 @@
+package ssm
+
+import "context"
+
+// If is a state which resolves to the "then" state if "pred" returns true for the context
+// it gets executed with, or to the "els" state otherwise.
+//
+// The branches are executed by the following steps of the machine.
+func If(pred func(context.Context) bool, then, els Fn) Fn {
+	if pred == nil {
+		return els
+	}
+	return func(ctx context.Context) Fn {
+		if pred(ctx) {
+			return then
+		}
+		return els
+	}
+}
+
+// Switch is a state which resolves to the state in "cases" corresponding to the value "key"
+// returns for the context it gets executed with, or to the "def" state if there's none.
+//
+// The "cases" map is copied, so modifying it afterwards doesn't change the Switch.
+func Switch(key func(context.Context) string, cases map[string]Fn, def Fn) Fn {
+	if key == nil {
+		return def
+	}
+	c := make(map[string]Fn, len(cases))
+	for k, fn := range cases {
+		c[k] = fn
+	}
+	return func(ctx context.Context) Fn {
+		if fn, ok := c[key(ctx)]; ok {
+			return fn
+		}
+		return def
+	}
+}
+
+// While executes the "body" state, until it reaches End, as long as "pred" returns true for
+// the context it gets executed with. The predicate is checked before every iteration.
+//
+// When the body resolves to an error state, the loop stops, and resolves to that error state.
+func While(pred func(context.Context) bool, body Fn) Fn {
+	if pred == nil || IsEnd(body) {
+		return End
+	}
+	w := while{pred: pred, body: body}
+	return w.run
+}
+
+type while struct {
+	pred func(context.Context) bool
+	body Fn
+}
+
+func (w while) run(ctx context.Context) Fn {
+	if !w.pred(ctx) {
+		return End
+	}
+	return Then(w.body, w.run)
+}
+
+// Repeat executes the "body" state, until it reaches End, "n" times.
+//
+// When the body resolves to an error state, the loop stops, and resolves to that error state.
+func Repeat(n int, body Fn) Fn {
+	if n <= 0 || IsEnd(body) {
+		return End
+	}
+	r := loop{n: n, body: body}
+	return r.run
+}
+
+type loop struct {
+	n    int
+	body Fn
+}
+
+func (r loop) run(_ context.Context) Fn {
+	next := End
+	if r.n > 1 {
+		next = loop{n: r.n - 1, body: r.body}.run
+	}
+	return Then(r.body, next)
+}
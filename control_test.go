@@ -0,0 +1,224 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+type mockFlag struct{}
+
+func flagOf(ctx context.Context) bool {
+	f, _ := ctx.Value(mockFlag{}).(bool)
+	return f
+}
+
+func TestIf(t *testing.T) {
+	tests := []struct {
+		name string
+		pred func(context.Context) bool
+		flag bool
+		want Fn
+	}{
+		{
+			name: "nil",
+			want: mockSelf,
+		},
+		{
+			name: "true",
+			pred: flagOf,
+			flag: true,
+			want: mockEmpty,
+		},
+		{
+			name: "false",
+			pred: flagOf,
+			want: mockSelf,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := If(tt.pred, mockEmpty, mockSelf)
+			if tt.pred != nil {
+				fn = fn(context.WithValue(context.Background(), mockFlag{}, tt.flag))
+			}
+			if !sameFns(fn, tt.want) {
+				t.Errorf("If() = %s, wanted %s", nameOf(fn), nameOf(tt.want))
+			}
+		})
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	type mockKey struct{}
+	key := func(ctx context.Context) string {
+		k, _ := ctx.Value(mockKey{}).(string)
+		return k
+	}
+	cases := map[string]Fn{
+		"empty": mockEmpty,
+		"self":  mockSelf,
+	}
+	tests := []struct {
+		name string
+		key  func(context.Context) string
+		val  string
+		want Fn
+	}{
+		{
+			name: "nil",
+			want: mockErr,
+		},
+		{
+			name: "first case",
+			key:  key,
+			val:  "empty",
+			want: mockEmpty,
+		},
+		{
+			name: "second case",
+			key:  key,
+			val:  "self",
+			want: mockSelf,
+		},
+		{
+			name: "default",
+			key:  key,
+			val:  "missing",
+			want: mockErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := Switch(tt.key, cases, mockErr)
+			if tt.key != nil {
+				fn = fn(context.WithValue(context.Background(), mockKey{}, tt.val))
+			}
+			if !sameFns(fn, tt.want) {
+				t.Errorf("Switch() = %s, wanted %s", nameOf(fn), nameOf(tt.want))
+			}
+		})
+	}
+}
+
+// mockSteps returns a state which takes two steps to reach End, and counts its iterations in "cnt".
+func mockSteps(cnt *int, last Fn) Fn {
+	return func(_ context.Context) Fn {
+		return func(_ context.Context) Fn {
+			*cnt++
+			return last
+		}
+	}
+}
+
+func TestWhile(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name     string
+		max      int
+		last     Fn
+		wantIter int
+		wantErr  error
+	}{
+		{
+			name: "never",
+			max:  0,
+		},
+		{
+			name:     "three times",
+			max:      3,
+			wantIter: 3,
+		},
+		{
+			name:     "error stops",
+			max:      3,
+			last:     ErrorEnd(errFailed),
+			wantIter: 1,
+			wantErr:  errFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iter := 0
+			pred := func(_ context.Context) bool {
+				return iter < tt.max
+			}
+			err := Run(context.Background(), While(pred, mockSteps(&iter, tt.last)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("While() error = %v, wanted %v", err, tt.wantErr)
+			}
+			if iter != tt.wantIter {
+				t.Errorf("While() iterated %d times, wanted %d", iter, tt.wantIter)
+			}
+		})
+	}
+	if fn := While(nil, mockEmpty); !IsEnd(fn) {
+		t.Errorf("While() with nil predicate = %s, wanted End", nameOf(fn))
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name     string
+		n        int
+		last     Fn
+		wantIter int
+		wantErr  error
+	}{
+		{
+			name: "zero",
+		},
+		{
+			name:     "once",
+			n:        1,
+			wantIter: 1,
+		},
+		{
+			name:     "five times",
+			n:        5,
+			wantIter: 5,
+		},
+		{
+			name:     "error stops",
+			n:        5,
+			last:     ErrorEnd(errFailed),
+			wantIter: 1,
+			wantErr:  errFailed,
+		},
+		{
+			// NOTE(marius): the iterations are built only when they get executed.
+			name:     "error stops a long loop",
+			n:        math.MaxInt,
+			last:     ErrorEnd(errFailed),
+			wantIter: 1,
+			wantErr:  errFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iter := 0
+			err := Run(context.Background(), Repeat(tt.n, mockSteps(&iter, tt.last)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Repeat() error = %v, wanted %v", err, tt.wantErr)
+			}
+			if iter != tt.wantIter {
+				t.Errorf("Repeat() iterated %d times, wanted %d", iter, tt.wantIter)
+			}
+		})
+	}
+}
+
+func TestRepeat_reentrant(t *testing.T) {
+	iter := 0
+	fn := Repeat(3, mockSteps(&iter, End))
+	for i := 1; i <= 2; i++ {
+		if err := Run(context.Background(), fn); err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+		if iter != 3*i {
+			t.Errorf("Repeat() iterated %d times after %d runs, wanted %d", iter, i, 3*i)
+		}
+	}
+}
@@ -3,17 +3,18 @@ package ssm
 import (
 	"context"
 	"reflect"
+	"strconv"
 )
 
 // ErrorEnd represents an error state which returns an End state.
 func ErrorEnd(err error) Fn {
-	return errState{err}.stop
+	return errState{error: err}.stop
 }
 
 // ErrorRestart represents an error state which returns the first iteration passed.
 // This iteration is loaded from the context, and is saved there by the Run and RunParallel functions.
 func ErrorRestart(err error) Fn {
-	return errState{err}.restart
+	return errState{error: err}.restart
 }
 
 // StartState retrieves the initial state from ctx context.Context.
@@ -34,12 +35,28 @@ func Cancel(ctx context.Context) context.CancelCauseFunc {
 	if cancel == nil {
 		return nil
 	}
-	if cancelFn, ok := cancel.(context.CancelCauseFunc); ok {
+	switch cancelFn := cancel.(type) {
+	case context.CancelCauseFunc:
 		return cancelFn
+	case namedCancel:
+		return func(cause error) {
+			cancelFn("", cause)
+		}
 	}
 	return nil
 }
 
+// cancelOf returns the cancel function found in the context, which, if it belongs to a Machine,
+// records the "name" of the Named state that returned the error state canceling it.
+func cancelOf(ctx context.Context, name string) context.CancelCauseFunc {
+	if cancelFn, ok := ctx.Value(__cancel).(namedCancel); ok {
+		return func(cause error) {
+			cancelFn(name, cause)
+		}
+	}
+	return Cancel(ctx)
+}
+
 type smKeys string
 
 const __start smKeys = "__start"
@@ -52,6 +69,42 @@ func (e errState) Error() string {
 
 type errState struct {
 	error
+	// name is the name of the Named state which returned the error state, if any.
+	name string
+}
+
+// StateError is the error returned by Run and RunParallel when the error state
+// that stopped the machine was returned by a Named state.
+type StateError struct {
+	State string
+	Err   error
+}
+
+func (e *StateError) Error() string {
+	return e.State + ": " + e.Err.Error()
+}
+
+func (e *StateError) Unwrap() error {
+	return e.Err
+}
+
+// BranchError is the error of one of the branches of a ParallelCollect state, which
+// is tagged with the position of the branch, and its name, if it's a Named state.
+type BranchError struct {
+	Index int
+	State string
+	Err   error
+}
+
+func (e *BranchError) Error() string {
+	if e.State != "" {
+		return e.State + ": " + e.Err.Error()
+	}
+	return "branch " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+func (e *BranchError) Unwrap() error {
+	return e.Err
 }
 
 type ErrorFn Fn
@@ -69,6 +122,20 @@ var (
 	_ptrEndRestart = ptrOf(errState{}.restart)
 )
 
+// errorOf returns the error of the "f" error state, by executing it with a context
+// where the cancel function only records the error.
+func errorOf(ctx context.Context, f Fn) error {
+	if !IsError(f) {
+		return nil
+	}
+	var err error
+	record := context.CancelCauseFunc(func(cause error) {
+		err = cause
+	})
+	f(context.WithValue(ctx, __cancel, record))
+	return err
+}
+
 // IsError ver grubby API to check if a state Fn is an error state
 func IsError(f Fn) bool {
 	p := ptrOf(f)
@@ -76,7 +143,7 @@ func IsError(f Fn) bool {
 }
 
 func (e errState) stop(ctx context.Context) Fn {
-	cancelFn := Cancel(ctx)
+	cancelFn := cancelOf(ctx, e.name)
 	if cancelFn != nil {
 		defer cancelFn(e.error)
 	}
@@ -84,7 +151,7 @@ func (e errState) stop(ctx context.Context) Fn {
 }
 
 func (e errState) restart(ctx context.Context) Fn {
-	cancelFn := Cancel(ctx)
+	cancelFn := cancelOf(ctx, e.name)
 	if cancelFn != nil {
 		defer cancelFn(e.error)
 	}
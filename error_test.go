@@ -50,7 +50,7 @@ func TestError(t *testing.T) {
 		{
 			name: "random err",
 			err:  fmt.Errorf("test"),
-			want: errState{fmt.Errorf("test")}.stop,
+			want: errState{error: fmt.Errorf("test")}.stop,
 		},
 	}
 	for _, tt := range tests {
@@ -82,13 +82,13 @@ func TestErrorRestart(t *testing.T) {
 		{
 			name: "random err, background context",
 			err:  fmt.Errorf("test"),
-			want: errState{fmt.Errorf("test")}.restart,
+			want: errState{error: fmt.Errorf("test")}.restart,
 		},
 		{
 			name:     "random err, start state in context",
 			err:      fmt.Errorf("test"),
 			ctx:      context.WithValue(context.Background(), __start, mockEmpty),
-			want:     errState{fmt.Errorf("test")}.restart,
+			want:     errState{error: fmt.Errorf("test")}.restart,
 			endState: mockEmpty,
 		},
 	}
@@ -0,0 +1,39 @@
+package ssm
+
+import (
+	"context"
+	"time"
+)
+
+// Hedge executes the "fn" state, and if it doesn't finish within "delay" time.Duration, it starts
+// another copy of it, up to "maxHedges" extra copies, each of them "delay" after the previous one.
+//
+// The first copy to finish wins: Hedge resolves to its next state, and the context of the other
+// copies is canceled, without waiting for them. Only the current execution of "fn" is hedged,
+// its next state is returned as is.
+//
+// The delays are measured using the Clock found in the context.
+func Hedge(delay time.Duration, maxHedges int, fn Fn) Fn {
+	if IsEnd(fn) || IsError(fn) {
+		return fn
+	}
+	if maxHedges < 0 {
+		maxHedges = 0
+	}
+	return func(ctx context.Context) Fn {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// NOTE(marius): the channel is buffered, so the copies which lost don't leak.
+		res := make(chan Fn, maxHedges+1)
+		go func() {
+			res <- exec(ctx, fn)
+		}()
+		for i := 1; i <= maxHedges; i++ {
+			go func(d time.Duration) {
+				res <- runAfter(d, fn)(ctx)
+			}(time.Duration(i) * delay)
+		}
+		return <-res
+	}
+}
@@ -0,0 +1,21 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHedge_errorFirst(t *testing.T) {
+	err := errors.New("failed")
+	fn := Hedge(time.Millisecond, 3, func(_ context.Context) Fn {
+		return ErrorEnd(err)
+	})
+	if got := Run(context.Background(), fn); !errors.Is(got, err) {
+		t.Errorf("Hedge() error = %v, wanted %v", got, err)
+	}
+	if got := Hedge(time.Millisecond, 1, End); !IsEnd(got) {
+		t.Errorf("Hedge() = %s, wanted End", nameOf(got))
+	}
+}
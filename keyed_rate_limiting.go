@@ -0,0 +1,162 @@
+package ssm
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// KeyedLimitOptions configures the cache of limit strategies used by KeyedRateLimitWithOptions
+// and KeyedRateLimitWithStrategy.
+type KeyedLimitOptions struct {
+	// MaxKeys is the maximum number of keys for which a LimitStrategy is kept.
+	// When it's exceeded, the strategy of the least recently used key is evicted.
+	// If it's not positive, DefaultMaxKeys is used.
+	MaxKeys int
+	// IdleTimeout is the time.Duration after which the LimitStrategy of a key which
+	// was not used gets evicted. If it's not positive, the strategies are evicted only
+	// when MaxKeys is exceeded.
+	IdleTimeout time.Duration
+}
+
+// DefaultMaxKeys is the number of keys for which KeyedRateLimit keeps a LimitStrategy.
+const DefaultMaxKeys = 1024
+
+// DefaultIdleTimeout is the time.Duration after which KeyedRateLimit evicts the LimitStrategy of an unused key.
+const DefaultIdleTimeout = 10 * time.Minute
+
+// InvalidKeyFn is the error returned by KeyedRateLimit when it doesn't receive a function for computing the keys.
+var InvalidKeyFn = errors.New("invalid rate limit key method")
+
+// KeyedRateLimit is a RateLimit state machine which keeps a separate LimitStrategyFn for every key
+// returned by "keyFn" for the context it gets executed with, like a tenant or a remote host.
+//
+// The strategies are created by the "factory" function the first time a key is encountered, and
+// they are kept for at most DefaultMaxKeys keys, evicting the least recently used, or the ones not
+// used for DefaultIdleTimeout.
+func KeyedRateLimit(keyFn func(context.Context) string, factory func() LimitStrategyFn, states ...Fn) Fn {
+	return KeyedRateLimitWithOptions(KeyedLimitOptions{IdleTimeout: DefaultIdleTimeout}, keyFn, factory, states...)
+}
+
+// KeyedRateLimitWithOptions is a KeyedRateLimit state machine which keeps the strategies as configured
+// by the "opts" KeyedLimitOptions.
+func KeyedRateLimitWithOptions(opts KeyedLimitOptions, keyFn func(context.Context) string, factory func() LimitStrategyFn, states ...Fn) Fn {
+	var strategy func() LimitStrategy
+	if factory != nil {
+		strategy = func() LimitStrategy {
+			return factory()
+		}
+	}
+	return keyedRateLimit(opts, keyFn, strategy, staggerLimit, states...)
+}
+
+// KeyedRateLimitWithStrategy is a KeyedRateLimitWithOptions state machine which keeps a LimitStrategy
+// for every key, and executes the states like RateLimitWithStrategy.
+func KeyedRateLimitWithStrategy(opts KeyedLimitOptions, keyFn func(context.Context) string, factory func() LimitStrategy, states ...Fn) Fn {
+	return keyedRateLimit(opts, keyFn, factory, limitExec, states...)
+}
+
+func keyedRateLimit(opts KeyedLimitOptions, keyFn func(context.Context) string, factory func() LimitStrategy, exec func(context.Context, LimitStrategy, ...Fn) Fn, states ...Fn) Fn {
+	if keyFn == nil {
+		return ErrorEnd(InvalidKeyFn)
+	}
+	if factory == nil {
+		return ErrorEnd(InvalidRateLimitFn)
+	}
+	if len(states) == 0 {
+		return End
+	}
+
+	l := newLimiters(opts, factory)
+	return func(ctx context.Context) Fn {
+		limit := l.get(ClockFrom(ctx).Now(), keyFn(ctx))
+		if limit == nil {
+			return ErrorEnd(InvalidRateLimitFn)
+		}
+		return exec(ctx, limit, states...)
+	}
+}
+
+// limiters is a least recently used cache of LimitStrategy values, which evicts idle entries.
+type limiters struct {
+	m sync.Mutex
+
+	max     int
+	idle    time.Duration
+	factory func() LimitStrategy
+
+	// lru contains the *limiter entries, with the most recently used at the front.
+	lru  *list.List
+	keys map[string]*list.Element
+}
+
+type limiter struct {
+	key      string
+	limit    LimitStrategy
+	lastUsed time.Time
+}
+
+func newLimiters(opts KeyedLimitOptions, factory func() LimitStrategy) *limiters {
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = DefaultMaxKeys
+	}
+	return &limiters{
+		max:     opts.MaxKeys,
+		idle:    opts.IdleTimeout,
+		factory: factory,
+		lru:     list.New(),
+		keys:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the LimitStrategy for "key", creating it if needed, and evicts the entries
+// which have been idle at the "now" time.
+func (l *limiters) get(now time.Time, key string) LimitStrategy {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.evictIdle(now)
+
+	if el, ok := l.keys[key]; ok {
+		lim := el.Value.(*limiter)
+		lim.lastUsed = now
+		l.lru.MoveToFront(el)
+		return lim.limit
+	}
+
+	limit := l.factory()
+	if !validLimit(limit) {
+		return nil
+	}
+	l.keys[key] = l.lru.PushFront(&limiter{key: key, limit: limit, lastUsed: now})
+	for l.lru.Len() > l.max {
+		l.remove(l.lru.Back())
+	}
+	return limit
+}
+
+func (l *limiters) evictIdle(now time.Time) {
+	if l.idle <= 0 {
+		return
+	}
+	for el := l.lru.Back(); el != nil; el = l.lru.Back() {
+		if now.Sub(el.Value.(*limiter).lastUsed) < l.idle {
+			return
+		}
+		l.remove(el)
+	}
+}
+
+func (l *limiters) remove(el *list.Element) {
+	l.lru.Remove(el)
+	delete(l.keys, el.Value.(*limiter).key)
+}
+
+// len returns the number of keys for which a LimitStrategy is kept.
+func (l *limiters) len() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.lru.Len()
+}
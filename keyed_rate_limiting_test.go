@@ -0,0 +1,172 @@
+package ssm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type mockKey struct{}
+
+func keyOf(ctx context.Context) string {
+	k, _ := ctx.Value(mockKey{}).(string)
+	return k
+}
+
+func TestKeyedRateLimit(t *testing.T) {
+	never := func() LimitStrategyFn { return func() (bool, time.Duration) { return false, 0 } }
+	tests := []struct {
+		name    string
+		keyFn   func(context.Context) string
+		factory func() LimitStrategyFn
+		states  []Fn
+		want    Fn
+	}{
+		{
+			name: "nil",
+			want: ErrorEnd(InvalidKeyFn),
+		},
+		{
+			name:  "nil factory",
+			keyFn: keyOf,
+			want:  ErrorEnd(InvalidRateLimitFn),
+		},
+		{
+			name:    "no states",
+			keyFn:   keyOf,
+			factory: never,
+			want:    End,
+		},
+		{
+			name:    "nil strategy",
+			keyFn:   keyOf,
+			factory: func() LimitStrategyFn { return nil },
+			states:  []Fn{mockEmpty},
+			want:    ErrorEnd(InvalidRateLimitFn),
+		},
+		{
+			name:    "not limited",
+			keyFn:   keyOf,
+			factory: never,
+			states:  []Fn{mockEmpty},
+			want:    mockEmpty,
+		},
+		{
+			name:    "fixed window",
+			keyFn:   keyOf,
+			factory: func() LimitStrategyFn { return FixedWindow(1, time.Millisecond) },
+			states:  []Fn{mockEmpty},
+			want:    mockEmpty,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := KeyedRateLimit(tt.keyFn, tt.factory, tt.states...)
+			if IsEnd(fn) || IsError(fn) {
+				if !sameEndStates(fn, tt.want) {
+					t.Errorf("KeyedRateLimit() = %v, wanted %v", nameOf(fn), nameOf(tt.want))
+				}
+				return
+			}
+			if got := fn(context.Background()); !sameEndStates(got, tt.want) {
+				t.Errorf("KeyedRateLimit() = %v, wanted %v", nameOf(got), nameOf(tt.want))
+			}
+		})
+	}
+}
+
+func TestKeyedRateLimit_perKey(t *testing.T) {
+	c := newTestClock()
+	ctx := WithClock(context.Background(), c)
+
+	// NOTE(marius): every key allows one execution, and then stalls the next ones for an hour.
+	factory := func() LimitStrategy { return TokenBucket(1./3600, 1) }
+	fn := KeyedRateLimitWithStrategy(KeyedLimitOptions{}, keyOf, factory, mockEmpty)
+
+	for _, key := range []string{"one", "two", "three"} {
+		start := time.Now()
+		if err := Run(context.WithValue(ctx, mockKey{}, key), fn); err != nil {
+			t.Errorf("Run() for key %q error = %v", key, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Run() for key %q got stalled for %s", key, elapsed)
+		}
+	}
+
+	tctx, cancel := context.WithTimeout(context.WithValue(ctx, mockKey{}, "one"), 10*time.Millisecond)
+	defer cancel()
+	if err := Run(tctx, fn); err == nil {
+		t.Errorf("Run() for key %q was not stalled", "one")
+	}
+}
+
+func TestLimiters_get(t *testing.T) {
+	created := 0
+	factory := func() LimitStrategy {
+		created++
+		return TokenBucket(1, 1)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		opts        KeyedLimitOptions
+		keys        []string
+		advance     time.Duration
+		wantCreated int
+		wantLen     int
+	}{
+		{
+			name:        "reused",
+			opts:        KeyedLimitOptions{MaxKeys: 2},
+			keys:        []string{"a", "a", "b", "a", "b"},
+			wantCreated: 2,
+			wantLen:     2,
+		},
+		{
+			name:        "least recently used evicted",
+			opts:        KeyedLimitOptions{MaxKeys: 2},
+			keys:        []string{"a", "b", "a", "c", "a", "b"},
+			wantCreated: 4,
+			wantLen:     2,
+		},
+		{
+			name:        "idle evicted",
+			opts:        KeyedLimitOptions{MaxKeys: 10, IdleTimeout: time.Minute},
+			keys:        []string{"a", "b", "c", "a"},
+			advance:     time.Minute,
+			wantCreated: 4,
+			wantLen:     1,
+		},
+		{
+			name:        "not idle",
+			opts:        KeyedLimitOptions{MaxKeys: 10, IdleTimeout: time.Minute},
+			keys:        []string{"a", "b", "c", "a"},
+			advance:     time.Second,
+			wantCreated: 3,
+			wantLen:     3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = 0
+			l := newLimiters(tt.opts, factory)
+			for i, key := range tt.keys {
+				// NOTE(marius): the time advances before the last key only.
+				at := now
+				if i == len(tt.keys)-1 {
+					at = now.Add(tt.advance)
+				}
+				if l.get(at, key) == nil {
+					t.Errorf("get(%q) = nil", key)
+				}
+			}
+			if created != tt.wantCreated {
+				t.Errorf("get() created %d strategies, wanted %d", created, tt.wantCreated)
+			}
+			if got := l.len(); got != tt.wantLen {
+				t.Errorf("len() = %d, wanted %d", got, tt.wantLen)
+			}
+		})
+	}
+}
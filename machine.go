@@ -0,0 +1,140 @@
+package ssm
+
+import "context"
+
+// Machine is a state machine which is executed manually, one step at a time, by calling its Step method.
+//
+// It is useful when the execution needs to be driven by an external loop, like the one of a game,
+// an event loop, or a test.
+type Machine struct {
+	step   func(context.Context, []Fn) []Fn
+	agg    aggregatorFn
+	obs    Observer
+	rec    bool
+	cause  *stopCause
+	start  Fn
+	states []Fn
+
+	started bool
+	done    bool
+	err     error
+
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// NewMachine creates a Machine which executes the received states sequentially, like Run does.
+func NewMachine(states ...Fn) *Machine {
+	return NewMachineWithOptions(Options{}, states...)
+}
+
+// NewMachineWithOptions creates a Machine which executes the received states as configured by the "opts" Options.
+func NewMachineWithOptions(opts Options, states ...Fn) *Machine {
+	m := Machine{step: batchStep, agg: batchExec}
+	if opts.Parallel {
+		n := opts.MaxParallel
+		m.step = func(ctx context.Context, states []Fn) []Fn {
+			return parallelStepN(ctx, n, states)
+		}
+		m.agg = parallelExec
+		if n > 0 {
+			m.agg = parallelNExec(n)
+		}
+	}
+	m.obs = opts.Observer
+	if m.obs == nil {
+		m.obs = nopObserver{}
+	}
+	m.cause = &stopCause{}
+	m.rec = opts.RecoverPanics
+
+	m.states = filterEndStates(append(make([]Fn, 0, len(states)), states...))
+	m.start = aggStates(m.agg, append(make([]Fn, 0, len(m.states)), m.states...)...)
+	return &m
+}
+
+// Step executes the current states of the Machine once, and accumulates their next states.
+//
+// It returns true when the machine has stopped, either by being reduced to End, or because of an error,
+// which is returned together with it. Once stopped, calling Step has no effect.
+func (m *Machine) Step(ctx context.Context) (bool, error) {
+	if m.done {
+		return true, m.err
+	}
+	if !m.started {
+		m.started = true
+		m.obs.OnStart(m.start)
+	}
+	if len(m.states) == 0 {
+		return m.stop(nil)
+	}
+
+	ctx = m.context(ctx)
+	select {
+	case <-ctx.Done():
+		return m.stop(context.Cause(ctx))
+	default:
+	}
+
+	prev := m.states
+	m.states = m.step(ctx, m.states)
+	if len(prev) > 1 {
+		// NOTE(marius): the branches have been reported by the step function, but
+		// the observer expects the transition of their aggregate as well.
+		m.obs.OnTransition(aggStates(m.agg, prev...), aggStates(m.agg, append(make([]Fn, 0, len(m.states)), m.states...)...))
+	}
+	if len(m.states) == 0 || ctx.Err() != nil {
+		return m.stop(context.Cause(ctx))
+	}
+	return false, nil
+}
+
+// Current returns the states which will be executed by the next call to Step.
+func (m *Machine) Current() []Fn {
+	return append(make([]Fn, 0, len(m.states)), m.states...)
+}
+
+// Err returns the error that stopped the Machine, if any.
+func (m *Machine) Err() error {
+	return m.err
+}
+
+// context returns the context the states get executed with, which is derived from "parent".
+// It gets cached, so the states that keep running between steps, like NonBlocking ones,
+// are not canceled as long as the caller uses the same "parent" context.
+// When "parent" changes, the previous context is canceled, so it doesn't leak.
+func (m *Machine) context(parent context.Context) context.Context {
+	if m.ctx != nil && m.parent == parent {
+		return m.ctx
+	}
+	if m.cancel != nil {
+		m.cancel(context.Canceled)
+	}
+	m.parent = parent
+
+	ctx, cancel := context.WithCancelCause(parent)
+	ctx = context.WithValue(ctx, __start, m.start)
+	ctx = context.WithValue(ctx, __cancel, m.cause.cancelFn(ctx, cancel))
+	ctx = context.WithValue(ctx, __observer, m.obs)
+	if m.rec {
+		ctx = context.WithValue(ctx, __recover, true)
+	}
+	m.ctx = ctx
+	m.cancel = cancel
+	return m.ctx
+}
+
+func (m *Machine) stop(err error) (bool, error) {
+	m.done = true
+	m.states = nil
+	m.err = m.cause.wrap(err)
+	if m.cancel != nil {
+		m.cancel(m.err)
+	}
+	if m.err != nil {
+		m.obs.OnError(m.err)
+	}
+	m.obs.OnEnd()
+	return true, m.err
+}
@@ -0,0 +1,131 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mockCounter(steps int) Fn {
+	var next Fn
+	next = func(_ context.Context) Fn {
+		if steps--; steps <= 0 {
+			return End
+		}
+		return next
+	}
+	return next
+}
+
+func TestMachine_Step(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		states    []Fn
+		wantSteps int
+		wantErr   error
+	}{
+		{
+			name:      "empty",
+			wantSteps: 1,
+		},
+		{
+			name:      "one state",
+			states:    []Fn{mockEmpty},
+			wantSteps: 1,
+		},
+		{
+			name:      "three steps",
+			states:    []Fn{mockCounter(3)},
+			wantSteps: 3,
+		},
+		{
+			name:      "three steps in parallel",
+			opts:      Options{Parallel: true},
+			states:    []Fn{mockCounter(3), mockCounter(2)},
+			wantSteps: 3,
+		},
+		{
+			name:      "with error",
+			states:    []Fn{mockErr},
+			wantSteps: 2,
+			wantErr:   errors.New("test"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMachineWithOptions(tt.opts, tt.states...)
+
+			steps := 0
+			for {
+				steps++
+				done, err := m.Step(context.Background())
+				if !done {
+					continue
+				}
+				if !reflect.DeepEqual(err, tt.wantErr) {
+					t.Errorf("Step() error = %v, wanted %v", err, tt.wantErr)
+				}
+				break
+			}
+			if steps != tt.wantSteps {
+				t.Errorf("Step() finished after %d steps, wanted %d", steps, tt.wantSteps)
+			}
+			if !reflect.DeepEqual(m.Err(), tt.wantErr) {
+				t.Errorf("Err() = %v, wanted %v", m.Err(), tt.wantErr)
+			}
+			if len(m.Current()) > 0 {
+				t.Errorf("Current() = %d states after the Machine stopped, wanted none", len(m.Current()))
+			}
+			if done, _ := m.Step(context.Background()); !done {
+				t.Errorf("Step() after stop = %t, wanted true", done)
+			}
+		})
+	}
+}
+
+func TestMachine_Current(t *testing.T) {
+	m := NewMachine(mockSelf, mockEmpty, End)
+
+	want := []Fn{mockSelf, mockEmpty}
+	if got := m.Current(); len(got) != len(want) || !sameFns(got[0], want[0]) || !sameFns(got[1], want[1]) {
+		t.Errorf("Current() = %d states, wanted %d", len(got), len(want))
+	}
+
+	if done, err := m.Step(context.Background()); done || err != nil {
+		t.Errorf("Step() = %t, %v, wanted false, nil", done, err)
+	}
+	if got := m.Current(); len(got) != 1 || !sameFns(got[0], mockSelf) {
+		t.Errorf("Current() = %d states, wanted only mockSelf", len(got))
+	}
+}
+
+func TestMachine_context(t *testing.T) {
+	var contexts []context.Context
+	var fn Fn
+	fn = func(ctx context.Context) Fn {
+		contexts = append(contexts, ctx)
+		return fn
+	}
+	m := NewMachine(fn)
+
+	type mockFrame struct{}
+	parent := context.WithValue(context.Background(), mockFrame{}, 1)
+	_, _ = m.Step(parent)
+	_, _ = m.Step(parent)
+	if contexts[0] != contexts[1] {
+		t.Errorf("Step() with the same parent context used different contexts")
+	}
+	if contexts[0].Err() != nil {
+		t.Errorf("Step() with the same parent context canceled the previous one: %v", contexts[0].Err())
+	}
+
+	_, _ = m.Step(context.WithValue(context.Background(), mockFrame{}, 2))
+	if contexts[1].Err() == nil {
+		t.Errorf("Step() with a different parent context didn't cancel the previous one")
+	}
+	if contexts[2].Err() != nil {
+		t.Errorf("Step() context is canceled: %v", contexts[2].Err())
+	}
+}
@@ -0,0 +1,126 @@
+package ssm
+
+import (
+	"context"
+	"sync"
+)
+
+// Named wraps the "fn" state under "name", which can be retrieved at runtime using NameOf.
+//
+// When the machine is stopped by an error state returned by a Named state, the error returned
+// by Run and RunParallel is a *StateError which carries the name.
+//
+// End and error states are returned unchanged, so IsEnd and IsError keep working on them.
+func Named(name string, fn Fn) Fn {
+	if IsEnd(fn) || IsError(fn) {
+		return fn
+	}
+	return named{name: name, fn: fn}.run
+}
+
+// NameOf returns the name the "fn" state received from Named.
+// If "fn" is not a Named state, it returns an empty string.
+func NameOf(fn Fn) string {
+	if ptrOf(fn) != _ptrNamed {
+		return ""
+	}
+	name := ""
+	fn(context.WithValue(context.Background(), __name, &name))
+	return name
+}
+
+const __name smKeys = "__name"
+
+type named struct {
+	name string
+	fn   Fn
+}
+
+var _ptrNamed = ptrOf(named{}.run)
+
+func (n named) run(ctx context.Context) Fn {
+	// NOTE(marius): NameOf calls us with a context containing where to store the name,
+	// and we must not execute the wrapped state in that case.
+	if dst, ok := ctx.Value(__name).(*string); ok {
+		*dst = n.name
+		return End
+	}
+	if cancelFn, ok := ctx.Value(__cancel).(namedCancel); ok {
+		ctx = context.WithValue(ctx, __cancel, cancelFn.as(n.name))
+	}
+	return namedError(n.name, n.fn(ctx))
+}
+
+// namedError returns the "f" error state tagged with "name", so when it cancels the machine,
+// the error gets attributed to the Named state which returned it.
+// States which are not errors, or which have been tagged by an inner Named state, are returned unchanged.
+func namedError(name string, f Fn) Fn {
+	if !IsError(f) {
+		return f
+	}
+	inner, err := "", error(nil)
+	record := namedCancel(func(n string, cause error) {
+		inner, err = n, cause
+	})
+	f(context.WithValue(context.Background(), __cancel, record))
+	if inner != "" {
+		return f
+	}
+
+	e := errState{error: err, name: name}
+	if ptrOf(f) == _ptrEndRestart {
+		return e.restart
+	}
+	return e.stop
+}
+
+// namedCancel is the cancel function of a Machine, which receives the name of the Named state
+// whose error state canceled it, if any.
+type namedCancel func(name string, cause error)
+
+// as returns the cancel function seen by the Named state "name", which attributes
+// the cancellations without a name to it.
+func (c namedCancel) as(name string) namedCancel {
+	return func(n string, cause error) {
+		if n == "" {
+			n = name
+		}
+		c(n, cause)
+	}
+}
+
+// stopCause keeps the error which canceled the context of a Machine first, together with
+// the name of the Named state that returned the error state, if any.
+type stopCause struct {
+	m sync.Mutex
+
+	set  bool
+	name string
+	err  error
+}
+
+// cancelFn returns the namedCancel function for the "ctx" context, which records the cause
+// if it's the one canceling it.
+func (s *stopCause) cancelFn(ctx context.Context, cancel context.CancelCauseFunc) namedCancel {
+	return func(name string, cause error) {
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		if !s.set && ctx.Err() == nil {
+			s.set, s.name, s.err = true, name, cause
+		}
+		cancel(cause)
+	}
+}
+
+// wrap returns the "err" error which stopped the machine as a *StateError, if the machine
+// has been canceled by an error state returned by one of the Named states.
+func (s *stopCause) wrap(err error) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if !s.set || s.err == nil || s.name == "" {
+		return err
+	}
+	return &StateError{State: s.name, Err: s.err}
+}
@@ -0,0 +1,173 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNamed(t *testing.T) {
+	tests := []struct {
+		name      string
+		stateName string
+		fn        Fn
+		wantName  string
+		wantEnd   bool
+		wantError bool
+	}{
+		{
+			name:      "End",
+			stateName: "end",
+			fn:        End,
+			wantName:  "",
+			wantEnd:   true,
+		},
+		{
+			name:      "ErrorEnd",
+			stateName: "error",
+			fn:        ErrorEnd(errors.New("test")),
+			wantName:  "",
+			wantError: true,
+		},
+		{
+			name:      "mockEmpty",
+			stateName: "empty",
+			fn:        mockEmpty,
+			wantName:  "empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Named(tt.stateName, tt.fn)
+			if n := NameOf(got); n != tt.wantName {
+				t.Errorf("NameOf() = %q, want %q", n, tt.wantName)
+			}
+			if IsEnd(got) != tt.wantEnd {
+				t.Errorf("IsEnd() = %t, want %t", IsEnd(got), tt.wantEnd)
+			}
+			if IsError(got) != tt.wantError {
+				t.Errorf("IsError() = %t, want %t", IsError(got), tt.wantError)
+			}
+		})
+	}
+}
+
+func TestNameOf(t *testing.T) {
+	executed := false
+	fn := func(ctx context.Context) Fn {
+		executed = true
+		return End
+	}
+	if n := NameOf(Named("test", fn)); n != "test" {
+		t.Errorf("NameOf() = %q, want %q", n, "test")
+	}
+	if executed {
+		t.Errorf("NameOf() executed the wrapped state")
+	}
+	if n := NameOf(fn); n != "" {
+		t.Errorf("NameOf() = %q for unnamed state, want empty", n)
+	}
+}
+
+func TestRunWithNamedError(t *testing.T) {
+	errB := errors.New("b failed")
+	blocked := func(ctx context.Context) Fn {
+		<-ctx.Done()
+		return End
+	}
+	slowEmpty := func(_ context.Context) Fn {
+		time.Sleep(10 * time.Millisecond)
+		return End
+	}
+	eof := func(_ context.Context) Fn { return ErrorEnd(io.EOF) }
+	tests := []struct {
+		name   string
+		states []Fn
+		want   error
+	}{
+		{
+			name:   "unnamed",
+			states: []Fn{mockErr},
+			want:   errors.New("test"),
+		},
+		{
+			name:   "named",
+			states: []Fn{Named("failing", mockErr)},
+			want:   &StateError{State: "failing", Err: errors.New("test")},
+		},
+		{
+			name:   "named in batch",
+			states: []Fn{Named("empty", mockEmpty), Named("failing", mockErr)},
+			want:   &StateError{State: "failing", Err: errors.New("test")},
+		},
+		{
+			name: "handled errors are not attributed",
+			states: []Fn{
+				Then(
+					Race(Named("replica", mockErr), mockEmpty),
+					func(_ context.Context) Fn { return ErrorEnd(errB) },
+				),
+			},
+			want: errB,
+		},
+		{
+			name: "handled timeouts are not attributed",
+			states: []Fn{
+				Then(
+					Race(Named("replica", Timeout(time.Millisecond, blocked)), slowEmpty),
+					Timeout(time.Millisecond, blocked),
+				),
+			},
+			want: context.DeadlineExceeded,
+		},
+		{
+			name:   "handled sentinel errors are not attributed",
+			states: []Fn{Then(Race(Named("replica", eof), slowEmpty), eof)},
+			want:   io.EOF,
+		},
+		{
+			name:   "inner names are kept",
+			states: []Fn{Named("outer", Named("inner", mockErr))},
+			want:   &StateError{State: "inner", Err: errors.New("test")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), tt.states...)
+			if !reflect.DeepEqual(err, tt.want) {
+				t.Errorf("Run() error = %v, wanted %v", err, tt.want)
+			}
+			if err = RunParallel(context.Background(), tt.states...); !reflect.DeepEqual(err, tt.want) {
+				t.Errorf("RunParallel() error = %v, wanted %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunWithNamedError_cause(t *testing.T) {
+	errs := map[string]error{
+		"a": errors.New("a failed"),
+		"b": errors.New("b failed"),
+	}
+	failing := func(name string) Fn {
+		return Named(name, func(_ context.Context) Fn {
+			return ErrorEnd(errs[name])
+		})
+	}
+
+	// NOTE(marius): both states fail in the same step, and in parallel either of them can stop the machine,
+	// but the name must always correspond to the error.
+	for i := 0; i < 20; i++ {
+		err := RunParallel(context.Background(), failing("a"), failing("b"))
+		var se *StateError
+		if !errors.As(err, &se) {
+			t.Fatalf("RunParallel() error = %v, wanted a *StateError", err)
+		}
+		if se.Err != errs[se.State] {
+			t.Errorf("RunParallel() error = %v, attributed to the wrong state", err)
+		}
+	}
+}
@@ -22,7 +22,7 @@ func (n nb) run(states ...Fn) Fn {
 	do := func(ctx context.Context, run Fn) func() {
 		return func() {
 			go func(ctx context.Context, run Fn) {
-				n <- run(ctx)
+				n <- exec(ctx, run)
 			}(ctx, run)
 		}
 	}
@@ -0,0 +1,37 @@
+package ssm
+
+import "context"
+
+// Observer receives notifications about the progress of a state machine started with RunWithOptions.
+//
+// When the machine contains Parallel aggregates, or it is started with Options.Parallel, the
+// OnTransition method is called from multiple goroutines, so implementations must be safe for concurrent use.
+type Observer interface {
+	// OnStart is called once, before the first state gets executed.
+	OnStart(start Fn)
+	// OnTransition is called every time a state has been executed and resolved to its next state.
+	// For Batch and Parallel aggregates it is called for each of their branches, as well as for the aggregate itself.
+	OnTransition(from, to Fn)
+	// OnError is called when the machine stops because of an error, just before OnEnd.
+	OnError(err error)
+	// OnEnd is called once, after the machine stops.
+	OnEnd()
+}
+
+const __observer smKeys = "__observer"
+
+type nopObserver struct{}
+
+func (nopObserver) OnStart(Fn)           {}
+func (nopObserver) OnTransition(_, _ Fn) {}
+func (nopObserver) OnError(error)        {}
+func (nopObserver) OnEnd()               {}
+
+// observer retrieves the Observer saved in ctx context.Context by RunWithOptions.
+// If nothing is found, it returns an Observer which ignores all notifications.
+func observer(ctx context.Context) Observer {
+	if o, ok := ctx.Value(__observer).(Observer); ok && o != nil {
+		return o
+	}
+	return nopObserver{}
+}
@@ -0,0 +1,90 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type recorder struct {
+	sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(ev string) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func (r *recorder) OnStart(start Fn) {
+	r.add("start")
+}
+
+func (r *recorder) OnTransition(from, to Fn) {
+	r.add(nameOf(from) + "->" + nameOf(to))
+}
+
+func (r *recorder) OnError(err error) {
+	r.add("error " + err.Error())
+}
+
+func (r *recorder) OnEnd() {
+	r.add("end")
+}
+
+func mockErr(_ context.Context) Fn {
+	return ErrorEnd(errors.New("test"))
+}
+
+func TestRunWithOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		states  []Fn
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "empty",
+			want: []string{"start", "end"},
+		},
+		{
+			name:   "one state",
+			states: []Fn{mockEmpty},
+			want:   []string{"start", "ssm.mockEmpty->End", "end"},
+		},
+		{
+			name:   "batch branches",
+			states: []Fn{mockEmpty, mockEmpty},
+			want:   []string{"start", "ssm.mockEmpty->End", "ssm.mockEmpty->End", "ssm.batchExec.func1->End", "end"},
+		},
+		{
+			name:   "parallel branches",
+			opts:   Options{Parallel: true},
+			states: []Fn{mockEmpty, mockEmpty},
+			want:   []string{"start", "ssm.mockEmpty->End", "ssm.mockEmpty->End", "ssm.parallelExec.func1->End", "end"},
+		},
+		{
+			name:    "with error",
+			states:  []Fn{mockErr},
+			want:    []string{"start", "ssm.mockErr->ssm.errState.stop-fm", "ssm.errState.stop-fm->End", "error test", "end"},
+			wantErr: errors.New("test"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recorder{}
+			tt.opts.Observer = &r
+			err := RunWithOptions(context.Background(), tt.opts, tt.states...)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("RunWithOptions() error = %v, wanted %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(r.events, tt.want) {
+				t.Errorf("RunWithOptions() observed %v, wanted %v", r.events, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package ssm
 
 import (
 	"context"
+	"errors"
+	"sort"
 )
 
 // Parallel executes the received states in parallel goroutines, and accumulates the next states.
@@ -16,21 +18,275 @@ func parallelExec(states ...Fn) Fn {
 	}
 
 	return func(ctx context.Context) Fn {
-		nextStates := make([]Fn, 0, len(states))
-		c := make(chan Fn, len(states))
+		return aggStates(parallelExec, parallelStep(ctx, states)...)
+	}
+}
 
-		for _, state := range states {
-			if IsEnd(state) {
-				continue
-			}
-			go func(st Fn) {
-				c <- st(ctx)
-			}(state)
+// ParallelFailFast executes the received states in parallel goroutines, like Parallel does, but
+// as soon as one of them resolves to an error state, it cancels the context of the others, and
+// returns the error state right away, without waiting for them to finish.
+//
+// Every step gets its own context, derived from the one of the machine, which is canceled with the
+// error of the failed branch, or with context.Canceled once all the branches of the step are done.
+// Because of this, the states should not use the context in goroutines which outlive the step.
+func ParallelFailFast(states ...Fn) Fn {
+	return aggStates(failFastExec, states...)
+}
+
+func failFastExec(states ...Fn) Fn {
+	if len(states) == 0 {
+		return End
+	}
+
+	return func(ctx context.Context) Fn {
+		next, failed, stopped := untilStep(ctx, states, IsError, func(st Fn) error {
+			return errorOf(ctx, st)
+		})
+		if stopped {
+			return failed
+		}
+		return aggStates(failFastExec, next...)
+	}
+}
+
+// untilStep executes each of the received states once, in parallel goroutines, and returns
+// the non End states they resolved to, or the first state one of them resolved to which fulfills "stop",
+// and true. In that case the context of the other states is canceled with the error returned by "cause" for it.
+func untilStep(ctx context.Context, states []Fn, stop func(Fn) bool, cause func(Fn) error) ([]Fn, Fn, bool) {
+	stepCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(context.Canceled)
+
+	nextStates := make([]Fn, 0, len(states))
+	res, cnt := fanOut(stepCtx, 0, states)
+	for i := 0; i < cnt; i++ {
+		st := (<-res).next
+		if stop(st) {
+			// NOTE(marius): the remaining branches send to the buffered channel, so they don't leak
+			// after we stop waiting for them.
+			cancel(cause(st))
+			return nil, st, true
+		}
+		if !IsEnd(st) {
+			nextStates = append(nextStates, st)
+		}
+	}
+	return nextStates, nil, false
+}
+
+// ParallelCollect executes the received states in parallel goroutines, like Parallel does, but
+// the branches which resolve to an error state don't stop the machine. Instead, their errors are
+// collected, and the others keep being executed until they reach End.
+//
+// Once all the branches are done, it resolves to an ErrorEnd state carrying the errors.Join of
+// the collected errors, each of them wrapped in a *BranchError, or to End if there were none.
+func ParallelCollect(states ...Fn) Fn {
+	c := collect{branches: newBranches(states)}
+	if len(c.branches) == 0 {
+		return End
+	}
+	return c.run
+}
+
+// branch is one of the states of a parallel execution, which keeps track of its position
+// in the initial states, and of its name.
+type branch struct {
+	index int
+	name  string
+	state Fn
+}
+
+func newBranches(states []Fn) []branch {
+	branches := make([]branch, 0, len(states))
+	for i, state := range states {
+		if IsEnd(state) {
+			continue
+		}
+		branches = append(branches, branch{index: i, name: NameOf(state), state: state})
+	}
+	return branches
+}
+
+func statesOf(branches []branch) []Fn {
+	states := make([]Fn, 0, len(branches))
+	for _, b := range branches {
+		states = append(states, b.state)
+	}
+	return states
+}
+
+type collect struct {
+	branches []branch
+	errs     []*BranchError
+}
+
+func (c collect) run(ctx context.Context) Fn {
+	res, cnt := fanOut(ctx, 0, statesOf(c.branches))
+
+	next := collect{
+		branches: make([]branch, 0, len(c.branches)),
+		errs:     append(make([]*BranchError, 0, len(c.errs)), c.errs...),
+	}
+	for i := 0; i < cnt; i++ {
+		r := <-res
+		b := c.branches[r.index]
+		switch {
+		case IsError(r.next):
+			next.errs = append(next.errs, b.error(errorOf(ctx, r.next)))
+		case !IsEnd(r.next):
+			b.state = r.next
+			next.branches = append(next.branches, b)
+		}
+	}
+
+	if len(next.branches) > 0 {
+		return next.run
+	}
+	return next.result()
+}
+
+// error tags "err" with the branch's name, or with the name of its current state if that is a Named one.
+func (b branch) error(err error) *BranchError {
+	name := NameOf(b.state)
+	if name == "" {
+		name = b.name
+	}
+	return &BranchError{Index: b.index, State: name, Err: err}
+}
+
+// result returns the ErrorEnd state for the collected errors.
+func (c collect) result() Fn {
+	if len(c.errs) == 0 {
+		return End
+	}
+	return ErrorEnd(errors.Join(sortedErrors(c.errs)...))
+}
+
+// sortedErrors returns the branch errors sorted by the position of their branches.
+func sortedErrors(branchErrs []*BranchError) []error {
+	sorted := append(make([]*BranchError, 0, len(branchErrs)), branchErrs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Index < sorted[j].Index
+	})
+	errs := make([]error, 0, len(sorted))
+	for _, err := range sorted {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ParallelN executes the received states in parallel goroutines, like Parallel does, but it
+// runs at most "n" of them at the same time. If "n" is not positive, there is no limit.
+// The resulting next state is returned as a ParallelN batch of all the non End states resolved.
+func ParallelN(n int, states ...Fn) Fn {
+	return aggStates(parallelNExec(n), states...)
+}
+
+func parallelNExec(n int) func(states ...Fn) Fn {
+	return func(states ...Fn) Fn {
+		if len(states) == 0 {
+			return End
 		}
 
-		for range states {
-			nextStates = append(nextStates, <-c)
+		return func(ctx context.Context) Fn {
+			return aggStates(parallelNExec(n), parallelStepN(ctx, n, states)...)
 		}
-		return aggStates(parallelExec, nextStates...)
 	}
 }
+
+// parallelStep executes each of the received states once, in parallel goroutines, and returns
+// the non End states they resolved to.
+func parallelStep(ctx context.Context, states []Fn) []Fn {
+	return parallelStepN(ctx, 0, states)
+}
+
+// parallelStepN is like parallelStep, but it runs at most "n" goroutines at the same time.
+// If "n" is not positive, there is no limit.
+func parallelStepN(ctx context.Context, n int, states []Fn) []Fn {
+	nextStates := make([]Fn, 0, len(states))
+	res, cnt := fanOut(ctx, n, states)
+	for i := 0; i < cnt; i++ {
+		if st := (<-res).next; !IsEnd(st) {
+			nextStates = append(nextStates, st)
+		}
+	}
+	return nextStates
+}
+
+// result is the next state a branch of a parallel execution resolved to, together with the
+// position of the branch in the executed states.
+type result struct {
+	index int
+	next  Fn
+}
+
+// fanOut executes each of the non End "states" once, in parallel goroutines, running at most "n" of
+// them at the same time, or all of them if "n" is not positive.
+//
+// It returns the channel which receives the results of the states, and how many of them it will receive.
+// The channel is buffered, so the goroutines don't leak if the caller stops receiving from it.
+func fanOut(ctx context.Context, n int, states []Fn) (<-chan result, int) {
+	res := make(chan result, len(states))
+	o := observer(ctx)
+
+	var sem chan struct{}
+	if n > 0 {
+		sem = make(chan struct{}, n)
+	}
+
+	cnt := 0
+	for i, state := range states {
+		if IsEnd(state) {
+			continue
+		}
+		cnt++
+		if sem != nil {
+			sem <- struct{}{}
+		}
+		go func(i int, st Fn) {
+			next := exec(ctx, st)
+			o.OnTransition(st, next)
+			if sem != nil {
+				<-sem
+			}
+			res <- result{index: i, next: next}
+		}(i, state)
+	}
+	return res, cnt
+}
+
+// fanOutUntil executes each of the non End "states" in its own goroutine, together with its following states,
+// until it resolves to End, to an error state, or to a state which fulfills "until", if it's not nil.
+// If the context gets canceled before that, the branch resolves to an ErrorEnd state carrying its cause.
+//
+// Unlike fanOut, the branches don't wait for each other between the steps, so the result of a branch
+// is received as soon as it's done.
+// It returns the channel which receives the results of the states, and how many of them it will receive.
+// The channel is buffered, so the goroutines don't leak if the caller stops receiving from it.
+func fanOutUntil(ctx context.Context, states []Fn, until func(Fn) bool) (<-chan result, int) {
+	res := make(chan result, len(states))
+	o := observer(ctx)
+
+	cnt := 0
+	for i, state := range states {
+		if IsEnd(state) {
+			continue
+		}
+		cnt++
+		go func(i int, st Fn) {
+			for {
+				next := exec(ctx, st)
+				o.OnTransition(st, next)
+				if IsEnd(next) || IsError(next) || (until != nil && until(next)) {
+					res <- result{index: i, next: next}
+					return
+				}
+				if err := context.Cause(ctx); err != nil {
+					res <- result{index: i, next: ErrorEnd(err)}
+					return
+				}
+				st = next
+			}
+		}(i, state)
+	}
+	return res, cnt
+}
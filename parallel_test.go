@@ -2,10 +2,13 @@ package ssm
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func mockSelf(_ context.Context) Fn {
@@ -87,3 +90,268 @@ func nameOf(f Fn) string {
 	name := filepath.Base(runtime.FuncForPC(p).Name())
 	return name
 }
+
+func TestParallelN(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		states []Fn
+		want   Fn
+	}{
+		{
+			name:   "nil",
+			states: nil,
+		},
+		{
+			name:   "with explicit nil",
+			n:      1,
+			states: []Fn{nil},
+		},
+		{
+			name:   "one fn",
+			n:      1,
+			states: []Fn{mockEmpty},
+			want:   mockEmpty,
+		},
+		{
+			name:   "two mock fns",
+			n:      1,
+			states: []Fn{mockEmpty, mockEmpty},
+			want:   ParallelN(1, mockEmpty, mockEmpty),
+		},
+		{
+			name:   "with End",
+			n:      2,
+			states: []Fn{End},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParallelN(tt.n, tt.states...)
+			if !sameFns(got, tt.want) {
+				t.Errorf("ParallelN() returned end state %q, expected %q", nameOf(got), nameOf(tt.want))
+			}
+		})
+	}
+}
+
+func TestParallelN_concurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		states  int
+		wantMax int32
+	}{
+		{name: "unlimited", n: 0, states: 5, wantMax: 5},
+		{name: "one", n: 1, states: 5, wantMax: 1},
+		{name: "three", n: 3, states: 10, wantMax: 3},
+		{name: "more than states", n: 10, states: 3, wantMax: 3},
+	}
+	runs := map[string]func(n int, states ...Fn) error{
+		"ParallelN": func(n int, states ...Fn) error {
+			return Run(context.Background(), ParallelN(n, states...))
+		},
+		"RunParallelN": func(n int, states ...Fn) error {
+			return RunParallelN(context.Background(), n, states...)
+		},
+	}
+	for runName, run := range runs {
+		for _, tt := range tests {
+			t.Run(runName+": "+tt.name, func(t *testing.T) {
+				cur, max := atomic.Int32{}, atomic.Int32{}
+				release := make(chan struct{})
+				states := make([]Fn, tt.states)
+				for i := range states {
+					states[i] = mockConcurrency(&cur, &max, release)
+				}
+
+				errc := make(chan error, 1)
+				go func() { errc <- run(tt.n, states...) }()
+
+				for cur.Load() < tt.wantMax {
+					time.Sleep(time.Millisecond)
+				}
+				// NOTE(marius): give the machine the chance to start more states than it should.
+				time.Sleep(5 * time.Millisecond)
+				close(release)
+
+				if err := <-errc; err != nil {
+					t.Errorf("%s() error = %v", runName, err)
+				}
+				if got := max.Load(); got != tt.wantMax {
+					t.Errorf("%s() ran %d concurrent states, wanted %d", runName, got, tt.wantMax)
+				}
+			})
+		}
+	}
+}
+
+func TestParallelFailFast(t *testing.T) {
+	err := errors.New("failed")
+	failing := func(_ context.Context) Fn {
+		return ErrorEnd(err)
+	}
+
+	tests := []struct {
+		name         string
+		states       func(canceled chan<- error) []Fn
+		wantErr      error
+		wantCanceled int
+	}{
+		{
+			name: "no errors",
+			states: func(_ chan<- error) []Fn {
+				return []Fn{mockEmpty, mockEmpty}
+			},
+		},
+		{
+			name: "one error",
+			states: func(_ chan<- error) []Fn {
+				return []Fn{mockEmpty, failing}
+			},
+			wantErr: err,
+		},
+		{
+			name: "siblings canceled",
+			states: func(canceled chan<- error) []Fn {
+				waiting := func(ctx context.Context) Fn {
+					<-ctx.Done()
+					canceled <- context.Cause(ctx)
+					return End
+				}
+				return []Fn{waiting, failing, waiting}
+			},
+			wantErr:      err,
+			wantCanceled: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canceled := make(chan error, 3)
+			states := tt.states(canceled)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if got := Run(ctx, ParallelFailFast(states...)); !errors.Is(got, tt.wantErr) {
+				t.Errorf("ParallelFailFast() error = %v, wanted %v", got, tt.wantErr)
+			}
+			for i := 0; i < tt.wantCanceled; i++ {
+				if cause := <-canceled; !errors.Is(cause, err) {
+					t.Errorf("ParallelFailFast() canceled sibling with %v, wanted %v", cause, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParallelFailFast_returnsEarly(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	blocked := func(_ context.Context) Fn {
+		<-release
+		return End
+	}
+	failing := func(_ context.Context) Fn {
+		return ErrorEnd(context.DeadlineExceeded)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- Run(context.Background(), ParallelFailFast(blocked, failing)) }()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ParallelFailFast() error = %v, wanted %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("ParallelFailFast() waited for the blocked branch")
+	}
+}
+
+func TestParallelCollect(t *testing.T) {
+	err1 := errors.New("first")
+	err2 := errors.New("second")
+	failing := func(err error) Fn {
+		return func(_ context.Context) Fn {
+			return ErrorEnd(err)
+		}
+	}
+	steps := func(n int, last Fn) Fn {
+		var fn Fn
+		fn = func(_ context.Context) Fn {
+			if n--; n > 0 {
+				return fn
+			}
+			return last
+		}
+		return fn
+	}
+
+	tests := []struct {
+		name    string
+		states  []Fn
+		wantErr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "no errors",
+			states: []Fn{mockEmpty, steps(3, End)},
+		},
+		{
+			name:    "one error",
+			states:  []Fn{mockEmpty, failing(err1)},
+			wantErr: "branch 1: first",
+		},
+		{
+			name:    "all errors",
+			states:  []Fn{steps(3, failing(err2)), mockEmpty, failing(err1)},
+			wantErr: "branch 0: second\nbranch 2: first",
+		},
+		{
+			name:    "named branches",
+			states:  []Fn{Named("one", failing(err1)), End, Named("two", steps(2, failing(err2)))},
+			wantErr: "one: first\ntwo: second",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), ParallelCollect(tt.states...))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ParallelCollect() error = %v, wanted nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParallelCollect() error = %v, wanted %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParallelCollect_branchErrors(t *testing.T) {
+	err := errors.New("failed")
+	failing := func(_ context.Context) Fn {
+		return ErrorEnd(err)
+	}
+
+	got := Run(context.Background(), ParallelCollect(mockEmpty, failing, Named("named", failing)))
+	if !errors.Is(got, err) {
+		t.Errorf("ParallelCollect() error = %v, wanted it to wrap %v", got, err)
+	}
+	var se *StateError
+	if errors.As(got, &se) {
+		t.Errorf("ParallelCollect() error = %v, should not be a *StateError", got)
+	}
+
+	var be *BranchError
+	if !errors.As(got, &be) {
+		t.Fatalf("ParallelCollect() error = %v, wanted a *BranchError", got)
+	}
+	if be.Index != 1 || be.State != "" {
+		t.Errorf("ParallelCollect() first error for branch %d %q, wanted %d %q", be.Index, be.State, 1, "")
+	}
+}
@@ -0,0 +1,69 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Quorum executes each of the received states in its own goroutine, together with its following states,
+// until "n" of them reach End without an error, when it resolves to End as well. The branches don't
+// wait for each other between their steps, so a slow branch doesn't delay the quorum.
+//
+// As soon as there are not enough branches left to reach "n", it resolves to an ErrorEnd state
+// carrying the errors.Join of the QuorumNotReached error and of the errors of the failed branches,
+// each of them wrapped in a *BranchError.
+//
+// In both cases the context of the remaining branches is canceled, and they are not waited for.
+// The End states received are ignored, so they don't count towards the quorum.
+func Quorum(n int, states ...Fn) Fn {
+	q := quorum{need: n, branches: newBranches(states)}
+	if q.need <= 0 {
+		return End
+	}
+	if len(q.branches) < q.need {
+		return q.failed()
+	}
+	return q.run
+}
+
+// QuorumNotReached is the error returned by a Quorum when too many of its branches have failed.
+var QuorumNotReached = errors.New("quorum not reached")
+
+type quorum struct {
+	need      int
+	succeeded int
+	branches  []branch
+	errs      []*BranchError
+}
+
+func (q quorum) run(ctx context.Context) Fn {
+	quorumCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(context.Canceled)
+
+	res, cnt := fanOutUntil(quorumCtx, statesOf(q.branches), nil)
+	for pending := cnt; pending > 0; {
+		r := <-res
+		pending--
+
+		if IsError(r.next) {
+			q.errs = append(q.errs, q.branches[r.index].error(errorOf(ctx, r.next)))
+		} else {
+			q.succeeded++
+		}
+
+		if q.succeeded >= q.need {
+			return End
+		}
+		if q.succeeded+pending < q.need {
+			cancel(QuorumNotReached)
+			return q.failed()
+		}
+	}
+	return q.failed()
+}
+
+func (q quorum) failed() Fn {
+	err := fmt.Errorf("%w: %d of %d branches succeeded", QuorumNotReached, q.succeeded, q.need)
+	return ErrorEnd(errors.Join(append([]error{err}, sortedErrors(q.errs)...)...))
+}
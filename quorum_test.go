@@ -0,0 +1,113 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuorum(t *testing.T) {
+	err1 := errors.New("first")
+	err2 := errors.New("second")
+	failing := func(err error) Fn {
+		return func(_ context.Context) Fn {
+			return ErrorEnd(err)
+		}
+	}
+	blocked := func(ctx context.Context) Fn {
+		<-ctx.Done()
+		return ErrorEnd(context.Cause(ctx))
+	}
+	later := func(fn Fn) Fn {
+		return func(_ context.Context) Fn {
+			return fn
+		}
+	}
+
+	tests := []struct {
+		name    string
+		n       int
+		states  []Fn
+		wantErr string
+	}{
+		{
+			name: "no quorum needed",
+			n:    0,
+		},
+		{
+			name:    "not enough branches",
+			n:       2,
+			states:  []Fn{mockEmpty, End},
+			wantErr: "quorum not reached: 0 of 2 branches succeeded",
+		},
+		{
+			name:   "all succeeded",
+			n:      2,
+			states: []Fn{mockEmpty, later(mockEmpty)},
+		},
+		{
+			name:   "reached without waiting",
+			n:      2,
+			states: []Fn{mockEmpty, blocked, failing(err1), mockEmpty},
+		},
+		{
+			name:    "failed without waiting",
+			n:       2,
+			states:  []Fn{failing(err1), blocked, failing(err2)},
+			wantErr: "quorum not reached: 0 of 2 branches succeeded\nbranch 0: first\nbranch 2: second",
+		},
+		{
+			name:    "failed after steps",
+			n:       2,
+			states:  []Fn{Named("one", later(failing(err1))), blocked, Named("two", later(later(failing(err2))))},
+			wantErr: "quorum not reached: 0 of 2 branches succeeded\none: first\ntwo: second",
+		},
+		{
+			// NOTE(marius): the branches don't wait for each other between steps, so the blocked one
+			// doesn't keep the others from reaching the quorum.
+			name:   "reached after steps",
+			n:      2,
+			states: []Fn{later(later(mockEmpty)), later(mockEmpty), blocked},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			err := Run(ctx, Quorum(tt.n, tt.states...))
+			if ctx.Err() != nil {
+				t.Errorf("Quorum() waited for the blocked branches")
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Quorum() error = %v, wanted nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Quorum() error = %v, wanted %q", err, tt.wantErr)
+			}
+			if !errors.Is(err, QuorumNotReached) {
+				t.Errorf("Quorum() error = %v, wanted it to wrap %v", err, QuorumNotReached)
+			}
+		})
+	}
+}
+
+func TestQuorum_remainingCanceled(t *testing.T) {
+	canceled := make(chan error, 1)
+	remaining := func(ctx context.Context) Fn {
+		<-ctx.Done()
+		canceled <- context.Cause(ctx)
+		return End
+	}
+
+	if err := Run(context.Background(), Quorum(1, mockEmpty, remaining)); err != nil {
+		t.Errorf("Quorum() error = %v", err)
+	}
+	if cause := <-canceled; !errors.Is(cause, context.Canceled) {
+		t.Errorf("Quorum() canceled remaining branch with %v, wanted %v", cause, context.Canceled)
+	}
+}
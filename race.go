@@ -0,0 +1,61 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+)
+
+// Race executes each of the received states in its own goroutine, together with its following states,
+// until the first of them reaches End. The branches don't wait for each other between their steps.
+// When one of them wins, the context of the other states is canceled with the RaceLost error,
+// and the Race resolves to End, without waiting for them.
+//
+// The branches which resolve to an error state drop out of the race. If all of them do, the Race
+// resolves to an ErrorEnd state carrying the errors.Join of NoRaceWinner and their errors.
+func Race(states ...Fn) Fn {
+	return RaceIf(IsEnd, states...)
+}
+
+// RaceIf is a Race state machine where the winner is the first branch which resolves to a state
+// that fulfills the "won" predicate, and which continues with that state.
+// The branches which reach End without winning drop out of the race.
+func RaceIf(won func(Fn) bool, states ...Fn) Fn {
+	if won == nil {
+		won = IsEnd
+	}
+	r := race{won: won, states: filterEndStates(append(make([]Fn, 0, len(states)), states...))}
+	if len(r.states) == 0 {
+		return End
+	}
+	return r.run
+}
+
+// RaceLost is the cause of the cancellation of the context of the branches which lost a Race.
+var RaceLost = errors.New("race lost")
+
+// NoRaceWinner is the error returned by a Race when all its branches dropped out.
+var NoRaceWinner = errors.New("race has no winner")
+
+type race struct {
+	won    func(Fn) bool
+	states []Fn
+}
+
+func (r race) run(ctx context.Context) Fn {
+	raceCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(context.Canceled)
+
+	errs := make([]error, len(r.states))
+	res, cnt := fanOutUntil(raceCtx, r.states, r.won)
+	for i := 0; i < cnt; i++ {
+		rr := <-res
+		if r.won(rr.next) {
+			cancel(RaceLost)
+			return rr.next
+		}
+		if IsError(rr.next) {
+			errs[rr.index] = errorOf(ctx, rr.next)
+		}
+	}
+	return ErrorEnd(errors.Join(append([]error{NoRaceWinner}, errs...)...))
+}
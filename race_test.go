@@ -0,0 +1,159 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRace(t *testing.T) {
+	err1 := errors.New("first")
+	err2 := errors.New("second")
+	failing := func(err error) Fn {
+		return func(_ context.Context) Fn {
+			return ErrorEnd(err)
+		}
+	}
+	slow := func(d time.Duration) Fn {
+		return func(ctx context.Context) Fn {
+			select {
+			case <-ctx.Done():
+				return ErrorEnd(context.Cause(ctx))
+			case <-time.After(d):
+				return End
+			}
+		}
+	}
+
+	mockSteps3 := func() Fn {
+		return func(_ context.Context) Fn {
+			return func(_ context.Context) Fn {
+				return mockEmpty
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		states  []Fn
+		wantErr []error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "with End",
+			states: []Fn{End},
+		},
+		{
+			name:   "one branch",
+			states: []Fn{mockEmpty},
+		},
+		{
+			name:   "fastest wins",
+			states: []Fn{slow(time.Minute), mockEmpty, slow(time.Minute)},
+		},
+		{
+			// NOTE(marius): the branches don't wait for each other between steps, so a branch
+			// with more steps can win against one which is still in its first step.
+			name:   "multiple steps win",
+			states: []Fn{mockSteps3(), slow(time.Minute)},
+		},
+		{
+			name:   "failures drop out",
+			states: []Fn{failing(err1), slow(10 * time.Millisecond)},
+		},
+		{
+			name:    "all failed",
+			states:  []Fn{failing(err1), failing(err2)},
+			wantErr: []error{NoRaceWinner, err1, err2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			err := Run(ctx, Race(tt.states...))
+			if ctx.Err() != nil {
+				t.Errorf("Race() waited for the slow branches")
+			}
+			if len(tt.wantErr) == 0 && err != nil {
+				t.Errorf("Race() error = %v, wanted nil", err)
+			}
+			for _, want := range tt.wantErr {
+				if !errors.Is(err, want) {
+					t.Errorf("Race() error = %v, wanted it to wrap %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRace_losersCanceled(t *testing.T) {
+	canceled := make(chan error, 2)
+	loser := func(ctx context.Context) Fn {
+		<-ctx.Done()
+		canceled <- context.Cause(ctx)
+		return End
+	}
+
+	if err := Run(context.Background(), Race(loser, mockEmpty, loser)); err != nil {
+		t.Errorf("Race() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if cause := <-canceled; !errors.Is(cause, RaceLost) {
+			t.Errorf("Race() canceled loser with %v, wanted %v", cause, RaceLost)
+		}
+	}
+}
+
+func TestRaceIf(t *testing.T) {
+	named := func(fn Fn) bool {
+		return NameOf(fn) == "winner"
+	}
+	continued := 0
+	winner := func(_ context.Context) Fn {
+		return Named("winner", func(_ context.Context) Fn {
+			continued++
+			return End
+		})
+	}
+
+	tests := []struct {
+		name          string
+		won           func(Fn) bool
+		states        []Fn
+		wantErr       error
+		wantContinued int
+	}{
+		{
+			name:          "continues with the winner",
+			won:           named,
+			states:        []Fn{winner, mockSelf},
+			wantContinued: 1,
+		},
+		{
+			name:    "End doesn't win",
+			won:     named,
+			states:  []Fn{mockEmpty, mockEmpty},
+			wantErr: NoRaceWinner,
+		},
+		{
+			name:   "nil predicate",
+			states: []Fn{mockEmpty, mockSelf},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			continued = 0
+			if err := Run(context.Background(), RaceIf(tt.won, tt.states...)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RaceIf() error = %v, wanted %v", err, tt.wantErr)
+			}
+			if continued != tt.wantContinued {
+				t.Errorf("RaceIf() continued with the winner %d times, wanted %d", continued, tt.wantContinued)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package ssm
 import (
 	"context"
 	"errors"
+	"math"
+	"sync"
 	"time"
 )
 
@@ -20,16 +22,54 @@ func RateLimit(limitFn LimitStrategyFn, states ...Fn) Fn {
 		return End
 	}
 	return func(ctx context.Context) Fn {
-		aggFn := batchExec
-		if stall, delay := limitFn(); stall {
-			aggFn = staggerExec(delay)
-		}
-		return aggStates(aggFn, states...)
+		return staggerLimit(ctx, limitFn, states...)
+	}
+}
+
+// RateLimitWithStrategy is a RateLimit state machine which uses the "limit" LimitStrategy
+// to determine if the current execution needs to be stalled.
+// It allows RateLimit to be used with the strategies which depend on the context, like TokenBucket or GCRA.
+//
+// Unlike RateLimit, which staggers the states, when the execution is stalled all the states
+// are executed after waiting for the delay.
+func RateLimitWithStrategy(limit LimitStrategy, states ...Fn) Fn {
+	if !validLimit(limit) {
+		return ErrorEnd(InvalidRateLimitFn)
+	}
+	if len(states) == 0 {
+		return End
+	}
+	return func(ctx context.Context) Fn {
+		return limitExec(ctx, limit, states...)
 	}
 }
 
 var InvalidRateLimitFn = errors.New("invalid rate limit method")
 
+// validLimit checks that "limit" is neither a nil interface, nor a nil LimitStrategyFn.
+func validLimit(limit LimitStrategy) bool {
+	fn, ok := limit.(LimitStrategyFn)
+	return limit != nil && (!ok || fn != nil)
+}
+
+// staggerLimit returns the aggregate of "states", which is staggered if the "limit" LimitStrategy requires stalling.
+func staggerLimit(ctx context.Context, limit LimitStrategy, states ...Fn) Fn {
+	aggFn := batchExec
+	if stall, delay := limit.Limit(ctx); stall {
+		aggFn = staggerExec(delay)
+	}
+	return aggStates(aggFn, states...)
+}
+
+// limitExec returns the aggregate of "states", which waits for the delay first if the "limit" LimitStrategy
+// requires stalling.
+func limitExec(ctx context.Context, limit LimitStrategy, states ...Fn) Fn {
+	if stall, delay := limit.Limit(ctx); stall {
+		return after(delay).run(states...)
+	}
+	return aggStates(batchExec, states...)
+}
+
 func staggerExec(delay time.Duration) func(states ...Fn) Fn {
 	return func(states ...Fn) Fn {
 		if len(states) == 0 {
@@ -38,13 +78,16 @@ func staggerExec(delay time.Duration) func(states ...Fn) Fn {
 
 		return func(ctx context.Context) Fn {
 			nextStates := make([]Fn, 0, len(states))
+			o := observer(ctx)
 
 			for i, state := range states {
 				if IsEnd(state) {
 					continue
 				}
 
-				st := after(time.Duration(i) * delay).run(state(ctx))
+				next := exec(ctx, state)
+				o.OnTransition(state, next)
+				st := after(time.Duration(i) * delay).run(next)
 
 				if !IsEnd(st) {
 					nextStates = append(nextStates, st)
@@ -60,14 +103,38 @@ func staggerExec(delay time.Duration) func(states ...Fn) Fn {
 // the desired rate limit.
 type LimitStrategyFn func() (bool, time.Duration)
 
+// Limit calls the LimitStrategyFn function, and returns its result.
+func (l LimitStrategyFn) Limit(_ context.Context) (bool, time.Duration) {
+	return l()
+}
+
+// LimitStrategy is used by the RateLimitWithStrategy state machine to determine if the current execution
+// requires stalling, and how much stalling is required to fulfill the desired rate limit.
+//
+// Unlike a LimitStrategyFn, it receives the context, so it can use the Clock found in it.
+//
+// The strategies of this package account for every execution, including the stalled ones, at the time
+// it's allowed to run, so a single strategy can be shared by parallel executions, like the branches
+// of RunParallel.
+type LimitStrategy interface {
+	Limit(ctx context.Context) (bool, time.Duration)
+}
+
+// FixedWindow stalls every "count"-th execution with "d"/"count" time.Duration.
+//
+// It can be shared safely by parallel executions.
 func FixedWindow(count int, d time.Duration) func() (bool, time.Duration) {
 	if count <= 0 {
 		count = 1
 	}
 	stallTime := d / time.Duration(count)
 	cnt := count
+	m := sync.Mutex{}
 
 	return func() (bool, time.Duration) {
+		m.Lock()
+		defer m.Unlock()
+
 		if cnt-1 > 0 {
 			cnt--
 			return false, 0
@@ -77,3 +144,205 @@ func FixedWindow(count int, d time.Duration) func() (bool, time.Duration) {
 		return true, stallTime
 	}
 }
+
+// SharedFixedWindow is a FixedWindow LimitStrategy which keeps its count in the counter of "key"
+// in the "store" CounterStore, so it can be shared by multiple processes.
+//
+// If the store returns an error, the execution is not stalled.
+func SharedFixedWindow(store CounterStore, key string, count int, d time.Duration) LimitStrategy {
+	if count <= 0 {
+		count = 1
+	}
+	return sharedWindow{store: store, key: key, count: int64(count), stall: d / time.Duration(count)}
+}
+
+type sharedWindow struct {
+	store CounterStore
+	key   string
+	count int64
+	stall time.Duration
+}
+
+func (s sharedWindow) Limit(ctx context.Context) (bool, time.Duration) {
+	n, err := s.store.Incr(ctx, s.key, 1, 0)
+	if err != nil || n%s.count != 0 {
+		return false, 0
+	}
+	return true, s.stall
+}
+
+// TokenBucket returns a LimitStrategy which allows bursts of up to "burst" executions, and refills
+// the bucket with "rate" executions per second. When the bucket is empty, the executions are stalled
+// until there's a token available for them.
+// If "rate" is not positive, the executions are never stalled.
+func TokenBucket(rate float64, burst int) LimitStrategy {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+type tokenBucket struct {
+	m sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (t *tokenBucket) Limit(ctx context.Context) (bool, time.Duration) {
+	if t.rate <= 0 {
+		return false, 0
+	}
+	now := ClockFrom(ctx).Now()
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if !t.last.IsZero() {
+		t.tokens = math.Min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	}
+	t.last = now
+
+	t.tokens--
+	if t.tokens >= 0 {
+		return false, 0
+	}
+	return true, durationOf(-t.tokens / t.rate)
+}
+
+// LeakyBucket returns a LimitStrategy which adds every execution to a bucket of "capacity" size,
+// which leaks "rate" executions per second. When the bucket would overflow, the executions are stalled
+// until enough of it has leaked.
+// If "rate" is not positive, the executions are never stalled.
+func LeakyBucket(rate float64, capacity int) LimitStrategy {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &leakyBucket{rate: rate, capacity: float64(capacity)}
+}
+
+type leakyBucket struct {
+	m sync.Mutex
+
+	rate     float64
+	capacity float64
+	level    float64
+	last     time.Time
+}
+
+func (l *leakyBucket) Limit(ctx context.Context) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return false, 0
+	}
+	now := ClockFrom(ctx).Now()
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if !l.last.IsZero() {
+		l.level = math.Max(0, l.level-now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	l.level++
+	if l.level <= l.capacity {
+		return false, 0
+	}
+	return true, durationOf((l.level - l.capacity) / l.rate)
+}
+
+// SlidingWindowLog returns a LimitStrategy which allows "count" executions in any "window" time.Duration.
+// It keeps a log of the times of the last "count" executions, and when it's full, the executions are
+// stalled until the oldest one leaves the window.
+func SlidingWindowLog(count int, window time.Duration) LimitStrategy {
+	if count < 1 {
+		count = 1
+	}
+	return &slidingLog{window: window, log: make([]time.Time, 0, count)}
+}
+
+type slidingLog struct {
+	m sync.Mutex
+
+	window time.Duration
+	// log contains the times of the last executions, sorted ascending, as a ring buffer starting at first.
+	log   []time.Time
+	first int
+}
+
+func (s *slidingLog) Limit(ctx context.Context) (bool, time.Duration) {
+	now := ClockFrom(ctx).Now()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if len(s.log) < cap(s.log) {
+		s.log = append(s.log, now)
+		return false, 0
+	}
+
+	at := now
+	if oldest := s.log[s.first]; now.Sub(oldest) < s.window {
+		at = oldest.Add(s.window)
+	}
+	s.log[s.first] = at
+	s.first = (s.first + 1) % len(s.log)
+
+	if wait := at.Sub(now); wait > 0 {
+		return true, wait
+	}
+	return false, 0
+}
+
+// GCRA returns a LimitStrategy which implements the Generic Cell Rate Algorithm, allowing
+// "rate" executions per second, with bursts of up to "burst" executions.
+//
+// It only keeps the theoretical arrival time of the next execution, which every execution advances.
+// If "rate" is not positive, the executions are never stalled.
+func GCRA(rate float64, burst int) LimitStrategy {
+	if burst < 1 {
+		burst = 1
+	}
+	g := gcra{}
+	if rate > 0 {
+		g.interval = durationOf(1 / rate)
+		g.tolerance = g.interval * time.Duration(burst-1)
+	}
+	return &g
+}
+
+type gcra struct {
+	m sync.Mutex
+
+	interval  time.Duration
+	tolerance time.Duration
+	tat       time.Time
+}
+
+func (g *gcra) Limit(ctx context.Context) (bool, time.Duration) {
+	if g.interval <= 0 {
+		return false, 0
+	}
+	now := ClockFrom(ctx).Now()
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	g.tat = tat.Add(g.interval)
+
+	if wait := tat.Add(-g.tolerance).Sub(now); wait > 0 {
+		return true, wait
+	}
+	return false, 0
+}
+
+// durationOf converts a number of seconds to a time.Duration.
+func durationOf(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
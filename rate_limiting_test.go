@@ -2,6 +2,7 @@ package ssm
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -129,3 +130,135 @@ func TestRateLimit(t *testing.T) {
 		})
 	}
 }
+
+func TestLimitStrategies(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		stalled bool
+		delay   time.Duration
+	}
+	tests := []struct {
+		name  string
+		limit LimitStrategy
+		steps []step
+	}{
+		{
+			name:  "token bucket: no rate",
+			limit: TokenBucket(0, 1),
+			steps: []step{{}, {}, {}},
+		},
+		{
+			name:  "token bucket: 10/s, burst 2",
+			limit: TokenBucket(10, 2),
+			steps: []step{
+				{},
+				{},
+				{stalled: true, delay: 100 * time.Millisecond},
+				{stalled: true, delay: 200 * time.Millisecond},
+				{advance: 300 * time.Millisecond},
+				{stalled: true, delay: 100 * time.Millisecond},
+				{advance: time.Second},
+				{},
+				{stalled: true, delay: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "leaky bucket: no rate",
+			limit: LeakyBucket(-1, 1),
+			steps: []step{{}, {}, {}},
+		},
+		{
+			name:  "leaky bucket: 10/s, capacity 2",
+			limit: LeakyBucket(10, 2),
+			steps: []step{
+				{},
+				{},
+				{stalled: true, delay: 100 * time.Millisecond},
+				{advance: 200 * time.Millisecond},
+				{stalled: true, delay: 100 * time.Millisecond},
+				{advance: time.Second},
+				{},
+			},
+		},
+		{
+			name:  "sliding window log: 2 / 100ms",
+			limit: SlidingWindowLog(2, 100*time.Millisecond),
+			steps: []step{
+				{},
+				{advance: 50 * time.Millisecond},
+				{stalled: true, delay: 50 * time.Millisecond},
+				{stalled: true, delay: 100 * time.Millisecond},
+				{advance: 100 * time.Millisecond, stalled: true, delay: 50 * time.Millisecond},
+				{stalled: true, delay: 100 * time.Millisecond},
+				{advance: time.Second},
+				{},
+			},
+		},
+		{
+			name:  "gcra: no rate",
+			limit: GCRA(0, 1),
+			steps: []step{{}, {}, {}},
+		},
+		{
+			name:  "gcra: 10/s, burst 2",
+			limit: GCRA(10, 2),
+			steps: []step{
+				{},
+				{},
+				{stalled: true, delay: 100 * time.Millisecond},
+				{stalled: true, delay: 200 * time.Millisecond},
+				{advance: time.Second},
+				{},
+				{stalled: true, delay: 100 * time.Millisecond},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClock()
+			ctx := WithClock(context.Background(), c)
+			for i, s := range tt.steps {
+				c.advance(s.advance)
+				stalled, delay := tt.limit.Limit(ctx)
+				if stalled != s.stalled {
+					t.Errorf("step %d invalid status %t, wanted %t", i, stalled, s.stalled)
+				}
+				if delay != s.delay {
+					t.Errorf("step %d invalid delay %s, wanted %s", i, delay, s.delay)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitStrategies_Parallel(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit LimitStrategy
+	}{
+		{name: "fixed window", limit: LimitStrategyFn(FixedWindow(5, 50*time.Millisecond))},
+		{name: "token bucket", limit: TokenBucket(100, 5)},
+		{name: "leaky bucket", limit: LeakyBucket(100, 5)},
+		{name: "sliding window log", limit: SlidingWindowLog(5, 50*time.Millisecond)},
+		{name: "gcra", limit: GCRA(100, 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnt := atomic.Int32{}
+			inc := func(_ context.Context) Fn {
+				cnt.Add(1)
+				return End
+			}
+			states := make([]Fn, 20)
+			for i := range states {
+				states[i] = RateLimitWithStrategy(tt.limit, inc)
+			}
+			if err := RunParallel(context.Background(), states...); err != nil {
+				t.Errorf("RunParallel() error = %v", err)
+			}
+			if int(cnt.Load()) != len(states) {
+				t.Errorf("RateLimitWithStrategy() executed %d states, wanted %d", cnt.Load(), len(states))
+			}
+		})
+	}
+}
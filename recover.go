@@ -0,0 +1,63 @@
+package ssm
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// Recover is a state machine which executes the "fn" state, and its following states, converting
+// any panic into an ErrorEnd state carrying a *PanicError.
+//
+// The panics that happen in the goroutines started by the Parallel, NonBlocking, Timeout
+// and After states are recovered as well.
+func Recover(fn Fn) Fn {
+	if IsEnd(fn) || IsError(fn) {
+		return fn
+	}
+	return func(ctx context.Context) Fn {
+		return Recover(exec(context.WithValue(ctx, __recover, true), fn))
+	}
+}
+
+// PanicError is the error returned when a state panics while panic recovery is enabled,
+// either through the Recover state, or the Options.RecoverPanics option.
+type PanicError struct {
+	// Value is the value received from recover().
+	Value any
+	// Stack is the stack trace of the goroutine which panicked.
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (p *PanicError) Unwrap() error {
+	if err, ok := p.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+const __recover smKeys = "__recover"
+
+func recoverEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(__recover).(bool)
+	return enabled
+}
+
+// exec executes the "state" Fn, and if panic recovery is enabled in ctx context.Context
+// it converts panics into an ErrorEnd state.
+func exec(ctx context.Context, state Fn) (next Fn) {
+	if !recoverEnabled(ctx) {
+		return state(ctx)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			next = ErrorEnd(&PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	return state(ctx)
+}
@@ -0,0 +1,109 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func mockPanic(_ context.Context) Fn {
+	panic("test")
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   Fn
+		wantErr bool
+	}{
+		{
+			name:  "End",
+			state: End,
+		},
+		{
+			name:  "no panic",
+			state: mockEmpty,
+		},
+		{
+			name:    "panic",
+			state:   mockPanic,
+			wantErr: true,
+		},
+		{
+			name:    "panic in next state",
+			state:   func(_ context.Context) Fn { return mockPanic },
+			wantErr: true,
+		},
+		{
+			name:    "panic in parallel branch",
+			state:   Parallel(mockEmpty, mockPanic),
+			wantErr: true,
+		},
+		{
+			name:    "panic in non blocking state",
+			state:   NonBlocking(mockPanic),
+			wantErr: true,
+		},
+		{
+			name:    "panic in timeout",
+			state:   Timeout(defaultDelay, mockPanic),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), Recover(tt.state))
+			checkPanicError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRunWithRecoverPanics(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		states []Fn
+	}{
+		{
+			name:   "sequential",
+			states: []Fn{mockEmpty, mockPanic},
+		},
+		{
+			name:   "parallel",
+			opts:   Options{Parallel: true},
+			states: []Fn{mockEmpty, mockPanic},
+		},
+		{
+			name:   "after",
+			states: []Fn{After(0, mockPanic)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.RecoverPanics = true
+			err := RunWithOptions(context.Background(), tt.opts, tt.states...)
+			checkPanicError(t, err, true)
+		})
+	}
+}
+
+func checkPanicError(t *testing.T, err error, wantErr bool) {
+	t.Helper()
+
+	if !wantErr {
+		if err != nil {
+			t.Errorf("Run() error = %v, wanted nil", err)
+		}
+		return
+	}
+	pe := new(PanicError)
+	if !errors.As(err, &pe) {
+		t.Fatalf("Run() error = %v, wanted *PanicError", err)
+	}
+	if pe.Value != "test" {
+		t.Errorf("PanicError.Value = %v, wanted %q", pe.Value, "test")
+	}
+	if len(pe.Stack) == 0 {
+		t.Errorf("PanicError.Stack is empty")
+	}
+}
@@ -2,7 +2,11 @@ package ssm
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -13,49 +17,180 @@ import (
 // The "fn" parameter can be one of the functions accepting a StrategyFn parameters,
 // which wrap the original state Fn, and which provide a way to delay the execution between retries.
 //
-// The Retry state machine is reentrant, therefore can be used from multiple goroutines.
+// The Retry state machine is reentrant, therefore can be used from multiple goroutines, and
+// every time it gets executed it starts with a fresh number of "retries".
+//
+// The "fn" state can find out which attempt it is executed for, and the error of the previous one,
+// using the Attempt and LastError functions.
 func Retry(count int, fn Fn) Fn {
 	return retries(count).run(fn)
 }
 
-type ar atomic.Int32
+// RetryIf is a Retry state machine which repeats the execution of "fn" only when the error
+// of the IsError state it returns is classified as retryable by the "retryable" function.
+// Any other error state is returned directly.
+func RetryIf(count int, retryable func(error) bool, fn Fn) Fn {
+	r := retries(count)
+	r.retryable = retryable
+	return r.run(fn)
+}
+
+type ar struct {
+	count     int32
+	retryable func(error) bool
+}
+
+func retries(count int) ar {
+	return ar{count: int32(count - 1)}
+}
 
-func retries(count int) *ar {
-	i := atomic.Int32{}
-	i.Store(int32(count - 1))
-	return (*ar)(&i)
+// run returns the state which starts a new series of retries every time it gets executed.
+func (r ar) run(fn Fn) Fn {
+	return func(ctx context.Context) Fn {
+		i := atomic.Int32{}
+		i.Store(r.count)
+		return r.attempt(&i, attempt{n: 1, start: ClockFrom(ctx).Now()}, fn)(ctx)
+	}
 }
 
-func (r *ar) run(fn Fn) Fn {
-	i := (*atomic.Int32)(r)
+func (r ar) attempt(i *atomic.Int32, a attempt, fn Fn) Fn {
 	return func(ctx context.Context) Fn {
-		for {
-			next := fn(ctx)
-			if !IsError(next) {
-				return next
-			}
-			if i.Load() > 0 {
-				i.Add(-1)
-				return r.run(fn)
-			}
+		next := fn(context.WithValue(ctx, __attempt, a))
+		if !IsError(next) {
+			return next
+		}
+		if i.Load() <= 0 {
+			return next
+		}
+		err := errorOf(ctx, next)
+		if r.retryable != nil && !r.retryable(err) {
 			return next
 		}
+		i.Add(-1)
+		return r.attempt(i, attempt{n: a.n + 1, err: err, start: a.start}, fn)
 	}
 }
 
+const __attempt smKeys = "__attempt"
+
+type attempt struct {
+	n     int
+	err   error
+	start time.Time
+}
+
+// Attempt returns the number of the current attempt, starting from 1, of the closest Retry
+// or BackOff state machine which executes the current state.
+// If the state is not executed by one of them, it returns 0.
+func Attempt(ctx context.Context) int {
+	a, _ := ctx.Value(__attempt).(attempt)
+	return a.n
+}
+
+// LastError returns the error of the previous attempt of the closest Retry or BackOff
+// state machine which executes the current state.
+// On the first attempt, or if the state is not executed by one of them, it returns nil.
+func LastError(ctx context.Context) error {
+	a, _ := ctx.Value(__attempt).(attempt)
+	return a.err
+}
+
 // StrategyFn is the type that returns the desired time.Duration for the BackOff function.
 type StrategyFn func() time.Duration
 
+// Next calls the StrategyFn function, and returns its result.
+func (s StrategyFn) Next() time.Duration {
+	return s()
+}
+
+// Reset does nothing, as a StrategyFn can not be reset.
+func (s StrategyFn) Reset() {}
+
+// Strategy is used by the BackOffWithStrategy state machine for determining the delays between executions.
+//
+// Unlike a StrategyFn, it can be reset to its initial delay, which BackOffWithStrategy does on
+// the first attempt of every series of executions of a Retry state machine.
+//
+// The Next method of a Strategy is a StrategyFn, so the strategies of this package can be used
+// with BackOff or Jitter too, like in BackOff(Exponential(base, 2, max).Next, fn), but they never
+// get reset in that case.
+type Strategy interface {
+	// Next returns the delay for the next execution.
+	Next() time.Duration
+	// Reset makes Next return the initial delay again.
+	Reset()
+}
+
 // BackOff returns an aggregator function which can be used to execute the received state with increasing delays.
 // The function for determining the delay is passed in the StrategyFn "dur" parameter.
 //
-// There is no end condition, so take care to limit the execution through some external method.
+// There is no end condition, so take care to limit the execution through some external method,
+// like BackOffFor, a Timeout, or a deadline on the context. If the next delay would end after the deadline
+// of the context, measured using the Clock found in it, BackOff fails immediately with the
+// BackOffDeadlineExceeded error, instead of waiting.
+//
+// When it's executed by a Retry state machine, "fn" can find out the current attempt using the
+// Attempt and LastError functions. Otherwise, as BackOff doesn't repeat "fn" itself, every execution
+// is the first attempt of its own.
 func BackOff(dur StrategyFn, fn Fn) Fn {
+	return BackOffWithStrategy(dur, fn)
+}
+
+// BackOffWithStrategy is a BackOff state machine which determines the delays using the "dur" Strategy,
+// and resets it on the first attempt of every series of executions of the closest Retry state machine.
+// It allows BackOff to be used with the resettable strategies, like Exponential or DecorrelatedJitter.
+//
+// When it's not executed by a Retry, the Strategy is never reset, so the delays keep escalating
+// with every execution, like the ones of a StrategyFn.
+func BackOffWithStrategy(dur Strategy, fn Fn) Fn {
+	return BackOffFor(0, dur, fn)
+}
+
+// BackOffFor is a BackOff state machine which fails with the BackOffElapsedExceeded error when
+// the next delay would end more than "maxElapsed" time.Duration after the first attempt.
+// If "maxElapsed" is not positive, there is no limit.
+//
+// The elapsed time is measured from the first attempt of the closest Retry state machine, or from
+// the start of the current execution if BackOffFor is not executed by a Retry.
+func BackOffFor(maxElapsed time.Duration, dur Strategy, fn Fn) Fn {
 	return func(ctx context.Context) Fn {
-		return after(dur()).run(fn)(ctx)
+		now := ClockFrom(ctx).Now()
+
+		a, ok := ctx.Value(__attempt).(attempt)
+		if !ok {
+			a = attempt{n: 1, start: now}
+			ctx = context.WithValue(ctx, __attempt, a)
+		} else if a.n == 1 {
+			// NOTE(marius): only a Retry starts a new series of executions, otherwise every
+			// execution would be the first one, and the Strategy would never escalate.
+			dur.Reset()
+		}
+
+		d := dur.Next()
+		if err := checkBackOff(ctx, now, a.start, maxElapsed, d); err != nil {
+			return ErrorEnd(err)
+		}
+		return after(d).run(fn)(ctx)
 	}
 }
 
+// BackOffElapsedExceeded is the error returned by BackOffFor when its next delay would exceed the maximum elapsed time.
+var BackOffElapsedExceeded = errors.New("back off maximum elapsed time exceeded")
+
+// BackOffDeadlineExceeded is the error returned by BackOff when its next delay would exceed the deadline of the context.
+var BackOffDeadlineExceeded = errors.New("back off delay exceeds the context deadline")
+
+func checkBackOff(ctx context.Context, now, start time.Time, maxElapsed, d time.Duration) error {
+	end := now.Add(d)
+	if maxElapsed > 0 && end.Sub(start) > maxElapsed {
+		return fmt.Errorf("%w: %s after %s", BackOffElapsedExceeded, d, now.Sub(start))
+	}
+	if deadline, ok := deadlineOf(ctx); ok && end.After(deadline) {
+		return fmt.Errorf("%w: %s with %s remaining", BackOffDeadlineExceeded, d, deadline.Sub(now))
+	}
+	return nil
+}
+
 // Constant returns a constant time.Duration for every call.
 func Constant(d time.Duration) StrategyFn {
 	return func() time.Duration {
@@ -68,7 +203,7 @@ func Linear(d time.Duration, m float64) StrategyFn {
 	return func() time.Duration {
 		t := d
 		// linearly increase duration for next run
-		d = time.Duration(m) * d
+		d = time.Duration(float64(d) * m)
 		return t
 	}
 }
@@ -85,3 +220,144 @@ func Jitter(max time.Duration, fn StrategyFn) StrategyFn {
 		return d + time.Duration(j)
 	}
 }
+
+// Exponential returns a Strategy which starts with the "base" delay, and multiplies it by "factor"
+// on every call, without exceeding "max". If "max" is not positive, the delay is not capped.
+//
+// It is safe to be used concurrently.
+func Exponential(base time.Duration, factor float64, max time.Duration) Strategy {
+	if max <= 0 {
+		max = math.MaxInt64
+	}
+	return &exponential{base: base, factor: factor, max: max}
+}
+
+type exponential struct {
+	m sync.Mutex
+
+	base   time.Duration
+	factor float64
+	max    time.Duration
+	n      int
+}
+
+func (e *exponential) Next() time.Duration {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	d := float64(e.base) * math.Pow(e.factor, float64(e.n))
+	if d < float64(e.max) {
+		// NOTE(marius): we stop incrementing the exponent once we reach the cap, to avoid overflows.
+		e.n++
+		return time.Duration(d)
+	}
+	return e.max
+}
+
+func (e *exponential) Reset() {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.n = 0
+}
+
+// FullJitter returns a Strategy which randomizes the delays of the "s" Strategy to
+// a value between 0 and the delay.
+//
+// The random values are generated from "src", or from the default source of the math/rand package if it's nil.
+func FullJitter(s Strategy, src rand.Source) Strategy {
+	return &jitter{s: s, r: newRandom(src)}
+}
+
+// EqualJitter returns a Strategy which keeps half of the delays of the "s" Strategy,
+// and randomizes the other half.
+//
+// The random values are generated from "src", or from the default source of the math/rand package if it's nil.
+func EqualJitter(s Strategy, src rand.Source) Strategy {
+	return &jitter{s: s, r: newRandom(src), equal: true}
+}
+
+type jitter struct {
+	s     Strategy
+	r     *random
+	equal bool
+}
+
+func (j *jitter) Next() time.Duration {
+	d := int64(j.s.Next())
+	if j.equal {
+		half := d / 2
+		return time.Duration(half + j.r.int63n(d-half))
+	}
+	return time.Duration(j.r.int63n(d))
+}
+
+func (j *jitter) Reset() {
+	j.s.Reset()
+}
+
+// DecorrelatedJitter returns a Strategy which computes every delay as a random value between "base"
+// and three times the previous delay, without exceeding "max".
+//
+// The random values are generated from "src", or from the default source of the math/rand package if it's nil.
+func DecorrelatedJitter(base, max time.Duration, src rand.Source) Strategy {
+	if max < base {
+		max = base
+	}
+	return &decorrelated{base: base, max: max, prev: base, r: newRandom(src)}
+}
+
+type decorrelated struct {
+	m sync.Mutex
+
+	base time.Duration
+	max  time.Duration
+	prev time.Duration
+	r    *random
+}
+
+func (d *decorrelated) Next() time.Duration {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	upper := int64(d.prev) * 3
+	if upper > int64(d.max) || upper < 0 {
+		upper = int64(d.max)
+	}
+	next := time.Duration(int64(d.base) + d.r.int63n(upper-int64(d.base)))
+	d.prev = next
+	return next
+}
+
+func (d *decorrelated) Reset() {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.prev = d.base
+}
+
+// random is a concurrency safe wrapper over a rand.Source.
+type random struct {
+	m sync.Mutex
+	r *rand.Rand
+}
+
+func newRandom(src rand.Source) *random {
+	if src == nil {
+		return &random{}
+	}
+	return &random{r: rand.New(src)}
+}
+
+// int63n returns a random number in [0, n), or 0 if n is not positive.
+func (r *random) int63n(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	if r.r == nil {
+		return rand.Int63n(n)
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.r.Int63n(n)
+}
@@ -2,7 +2,10 @@ package ssm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -99,3 +102,426 @@ func TestRetry(t *testing.T) {
 		})
 	}
 }
+
+func mockFailures(cnt *int, err error) Fn {
+	return func(_ context.Context) Fn {
+		*cnt++
+		return ErrorEnd(err)
+	}
+}
+
+func TestRetryFreshBudget(t *testing.T) {
+	cnt := 0
+	retry := Retry(3, mockFailures(&cnt, errors.New("fail")))
+
+	for i := 1; i <= 2; i++ {
+		if err := Run(context.Background(), retry); err == nil {
+			t.Errorf("Run() %d error = nil, want error", i)
+		}
+		if cnt != 3*i {
+			t.Errorf("Retry() executed state %d times after %d runs, want %d", cnt, i, 3*i)
+		}
+	}
+}
+
+var errRetryable = errors.New("retryable")
+
+func TestRetryIf(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantCnt int
+	}{
+		{
+			name:    "retryable",
+			err:     errRetryable,
+			wantCnt: 3,
+		},
+		{
+			name:    "wrapped retryable",
+			err:     fmt.Errorf("wrapped: %w", errRetryable),
+			wantCnt: 3,
+		},
+		{
+			name:    "not retryable",
+			err:     errors.New("permanent"),
+			wantCnt: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnt := 0
+			retry := RetryIf(3, func(err error) bool {
+				return errors.Is(err, errRetryable)
+			}, mockFailures(&cnt, tt.err))
+
+			if err := Run(context.Background(), retry); !errors.Is(err, tt.err) {
+				t.Errorf("Run() error = %v, want %v", err, tt.err)
+			}
+			if cnt != tt.wantCnt {
+				t.Errorf("RetryIf() executed state %d times, want %d", cnt, tt.wantCnt)
+			}
+		})
+	}
+}
+
+type attemptLog struct {
+	n   int
+	err error
+}
+
+func mockRecordAttempts(log *[]attemptLog, failures int) Fn {
+	return func(ctx context.Context) Fn {
+		*log = append(*log, attemptLog{n: Attempt(ctx), err: LastError(ctx)})
+		if len(*log) <= failures {
+			return ErrorEnd(fmt.Errorf("fail %d", len(*log)))
+		}
+		return End
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(Fn) Fn
+		runs int
+		want []attemptLog
+	}{
+		{
+			name: "no retry",
+			fn:   func(fn Fn) Fn { return fn },
+			runs: 1,
+			want: []attemptLog{{n: 0}},
+		},
+		{
+			name: "retry",
+			fn:   func(fn Fn) Fn { return Retry(5, fn) },
+			runs: 1,
+			want: []attemptLog{
+				{n: 1},
+				{n: 2, err: errors.New("fail 1")},
+				{n: 3, err: errors.New("fail 2")},
+			},
+		},
+		{
+			name: "retry with back off",
+			fn:   func(fn Fn) Fn { return Retry(5, BackOff(Constant(0), fn)) },
+			runs: 1,
+			want: []attemptLog{
+				{n: 1},
+				{n: 2, err: errors.New("fail 1")},
+				{n: 3, err: errors.New("fail 2")},
+			},
+		},
+		{
+			name: "back off",
+			fn:   func(fn Fn) Fn { return BackOff(Constant(0), fn) },
+			runs: 3,
+			want: []attemptLog{{n: 1}, {n: 1}, {n: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := make([]attemptLog, 0)
+			st := tt.fn(mockRecordAttempts(&log, 2))
+			for i := 0; i < tt.runs; i++ {
+				_ = Run(context.Background(), st)
+			}
+			if len(log) != len(tt.want) {
+				t.Fatalf("executed %d attempts, want %d", len(log), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := log[i]
+				if got.n != want.n {
+					t.Errorf("Attempt() %d = %d, want %d", i, got.n, want.n)
+				}
+				if (got.err == nil) != (want.err == nil) || (got.err != nil && got.err.Error() != want.err.Error()) {
+					t.Errorf("LastError() %d = %v, want %v", i, got.err, want.err)
+				}
+			}
+		})
+	}
+}
+
+func TestLinear(t *testing.T) {
+	s := Linear(10*time.Millisecond, 1.5)
+	want := []time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 22500 * time.Microsecond}
+	for i, w := range want {
+		if got := s(); got != w {
+			t.Errorf("Linear() call %d = %s, want %s", i, got, w)
+		}
+	}
+}
+
+func TestExponential(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   time.Duration
+		factor float64
+		max    time.Duration
+		want   []time.Duration
+	}{
+		{
+			name:   "doubling",
+			base:   time.Millisecond,
+			factor: 2,
+			want:   []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond},
+		},
+		{
+			name:   "capped",
+			base:   time.Millisecond,
+			factor: 3,
+			max:    10 * time.Millisecond,
+			want:   []time.Duration{time.Millisecond, 3 * time.Millisecond, 9 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Exponential(tt.base, tt.factor, tt.max)
+			for i, want := range tt.want {
+				if got := s.Next(); got != want {
+					t.Errorf("Exponential() call %d = %s, want %s", i, got, want)
+				}
+			}
+			s.Reset()
+			if got := s.Next(); got != tt.base {
+				t.Errorf("Exponential() after Reset = %s, want %s", got, tt.base)
+			}
+		})
+	}
+}
+
+func TestJitterStrategies(t *testing.T) {
+	const seed = 42
+	tests := []struct {
+		name string
+		new  func(src rand.Source) Strategy
+		min  []time.Duration
+		max  []time.Duration
+	}{
+		{
+			name: "full jitter",
+			new: func(src rand.Source) Strategy {
+				return FullJitter(Exponential(10*time.Millisecond, 2, 0), src)
+			},
+			min: []time.Duration{0, 0, 0},
+			max: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond},
+		},
+		{
+			name: "equal jitter",
+			new: func(src rand.Source) Strategy {
+				return EqualJitter(Exponential(10*time.Millisecond, 2, 0), src)
+			},
+			min: []time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond},
+			max: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond},
+		},
+		{
+			name: "decorrelated jitter",
+			new: func(src rand.Source) Strategy {
+				return DecorrelatedJitter(10*time.Millisecond, 50*time.Millisecond, src)
+			},
+			min: []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+			max: []time.Duration{30 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s1 := tt.new(rand.NewSource(seed))
+			s2 := tt.new(rand.NewSource(seed))
+			for i := range tt.min {
+				d1, d2 := s1.Next(), s2.Next()
+				if d1 != d2 {
+					t.Errorf("call %d is not reproducible with the same source: %s != %s", i, d1, d2)
+				}
+				if d1 < tt.min[i] || d1 > tt.max[i] {
+					t.Errorf("call %d = %s, want between %s and %s", i, d1, tt.min[i], tt.max[i])
+				}
+			}
+
+			s1.Reset()
+			for i := range tt.min {
+				if d := s1.Next(); d < tt.min[i] || d > tt.max[i] {
+					t.Errorf("call %d after Reset = %s, want between %s and %s", i, d, tt.min[i], tt.max[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBackOffResetsStrategy(t *testing.T) {
+	delays := make([]time.Duration, 0)
+	s := Exponential(time.Microsecond, 2, 0)
+	record := StrategyFn(func() time.Duration {
+		d := s.Next()
+		delays = append(delays, d)
+		return d
+	})
+	reset := resettable{Strategy: record, reset: s.Reset}
+
+	st := Retry(3, BackOffWithStrategy(reset, mockErr))
+	_ = Run(context.Background(), st)
+	_ = Run(context.Background(), st)
+
+	want := []time.Duration{
+		time.Microsecond, 2 * time.Microsecond, 4 * time.Microsecond,
+		time.Microsecond, 2 * time.Microsecond, 4 * time.Microsecond,
+	}
+	if len(delays) != len(want) {
+		t.Fatalf("BackOffWithStrategy() used %d delays, want %d", len(delays), len(want))
+	}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("BackOffWithStrategy() delay %d = %s, want %s", i, delays[i], want[i])
+		}
+	}
+}
+
+func TestBackOffEscalatesWithoutRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(s Strategy, fn Fn) Fn
+	}{
+		{
+			name: "BackOffWithStrategy",
+			fn: func(s Strategy, fn Fn) Fn {
+				return BackOffWithStrategy(s, fn)
+			},
+		},
+		{
+			name: "BackOff",
+			fn: func(s Strategy, fn Fn) Fn {
+				return BackOff(s.Next, fn)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays := make([]time.Duration, 0)
+			s := Exponential(time.Microsecond, 2, 0)
+			record := StrategyFn(func() time.Duration {
+				d := s.Next()
+				delays = append(delays, d)
+				return d
+			})
+
+			st := tt.fn(resettable{Strategy: record, reset: s.Reset}, mockEmpty)
+			for i := 0; i < 3; i++ {
+				_ = Run(context.Background(), st)
+			}
+
+			want := []time.Duration{time.Microsecond, 2 * time.Microsecond, 4 * time.Microsecond}
+			if !reflect.DeepEqual(delays, want) {
+				t.Errorf("%s() delays = %v, want %v", tt.name, delays, want)
+			}
+		})
+	}
+}
+
+type resettable struct {
+	Strategy
+	reset func()
+}
+
+func (r resettable) Reset() {
+	r.reset()
+}
+
+func TestBackOffFor(t *testing.T) {
+	fail := errors.New("fail")
+	tests := []struct {
+		name    string
+		runs    int
+		fn      func(s Strategy, fn Fn) Fn
+		wantErr error
+		wantCnt int
+	}{
+		{
+			name: "with retry",
+			runs: 1,
+			fn: func(s Strategy, fn Fn) Fn {
+				return Retry(10, BackOffFor(25*time.Millisecond, s, fn))
+			},
+			wantErr: BackOffElapsedExceeded,
+			wantCnt: 3,
+		},
+		{
+			// NOTE(marius): without a Retry every execution measures the elapsed time from its own start,
+			// so the failures of the previous ones don't count towards it.
+			name: "without retry",
+			runs: 4,
+			fn: func(s Strategy, fn Fn) Fn {
+				return BackOffFor(25*time.Millisecond, s, fn)
+			},
+			wantErr: fail,
+			wantCnt: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			ctx := WithClock(context.Background(), clock)
+
+			// NOTE(marius): the strategy advances the clock instead of waiting
+			advance := StrategyFn(func() time.Duration {
+				clock.advance(10 * time.Millisecond)
+				return 0
+			})
+
+			cnt := 0
+			st := tt.fn(advance, mockFailures(&cnt, fail))
+
+			var err error
+			for i := 0; i < tt.runs; i++ {
+				err = Run(ctx, st)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if cnt != tt.wantCnt {
+				t.Errorf("BackOffFor() executed state %d times, want %d", cnt, tt.wantCnt)
+			}
+		})
+	}
+}
+
+func TestBackOffDeadline(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		fn   func(fn Fn) Fn
+	}{
+		{
+			name: "context deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			fn: func(fn Fn) Fn { return fn },
+		},
+		{
+			name: "timeout with clock",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(WithClock(context.Background(), newTestClock()))
+			},
+			fn: func(fn Fn) Fn { return Timeout(100*time.Millisecond, fn) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			cnt := 0
+			st := time.Now()
+			err := Run(ctx, tt.fn(BackOff(Constant(time.Second), mockFailures(&cnt, errors.New("fail")))))
+			if !errors.Is(err, BackOffDeadlineExceeded) {
+				t.Errorf("Run() error = %v, want %v", err, BackOffDeadlineExceeded)
+			}
+			if cnt != 0 {
+				t.Errorf("BackOff() executed state %d times, want %d", cnt, 0)
+			}
+			if elapsed := time.Since(st); elapsed >= 100*time.Millisecond {
+				t.Errorf("BackOff() failed after %s, want immediately", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package ssm
+
+import "context"
+
+// Sequence executes the received states one after the other: each of them is executed, together
+// with its following states, until it reaches End, and only then the next one starts.
+//
+// Unlike Batch, which advances all its states one step at a time, Sequence advances only the
+// current one. When the current state resolves to an error state, the sequence stops, and
+// resolves to that error state.
+func Sequence(states ...Fn) Fn {
+	states = filterEndStates(append(make([]Fn, 0, len(states)), states...))
+	if len(states) == 0 {
+		return End
+	}
+	if len(states) == 1 {
+		return states[0]
+	}
+	return sequence(states).run
+}
+
+// Then executes the "first" state until it reaches End, and then the "next" one.
+// It is the same as Sequence(first, next).
+func Then(first, next Fn) Fn {
+	return Sequence(first, next)
+}
+
+type sequence []Fn
+
+func (s sequence) run(ctx context.Context) Fn {
+	next := exec(ctx, s[0])
+	observer(ctx).OnTransition(s[0], next)
+
+	if IsError(next) {
+		return next
+	}
+	if IsEnd(next) {
+		return Sequence(s[1:]...)
+	}
+	return append(sequence{next}, s[1:]...).run
+}
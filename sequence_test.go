@@ -0,0 +1,111 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []Fn
+		want   Fn
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:   "with End",
+			states: []Fn{End, End},
+		},
+		{
+			name:   "one fn",
+			states: []Fn{mockEmpty, End},
+			want:   mockEmpty,
+		},
+		{
+			name:   "two fns",
+			states: []Fn{mockEmpty, mockSelf},
+			want:   sequence{}.run,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sequence(tt.states...)
+			if !sameFns(got, tt.want) {
+				t.Errorf("Sequence() = %q, expected %q", nameOf(got), nameOf(tt.want))
+			}
+		})
+	}
+}
+
+func TestSequence_order(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	m := sync.Mutex{}
+	var log []string
+	steps := func(name string, n int, last Fn) Fn {
+		var fn Fn
+		fn = func(_ context.Context) Fn {
+			m.Lock()
+			log = append(log, name)
+			m.Unlock()
+			if n--; n > 0 {
+				return fn
+			}
+			return last
+		}
+		return fn
+	}
+
+	tests := []struct {
+		name    string
+		states  func() []Fn
+		wantLog []string
+		wantErr error
+	}{
+		{
+			name: "each until End",
+			states: func() []Fn {
+				return []Fn{steps("a", 3, End), steps("b", 2, End), steps("c", 1, End)}
+			},
+			wantLog: []string{"a", "a", "a", "b", "b", "c"},
+		},
+		{
+			name: "batch elements",
+			states: func() []Fn {
+				return []Fn{Batch(steps("a", 2, End), steps("b", 1, End)), steps("c", 1, End)}
+			},
+			wantLog: []string{"a", "b", "a", "c"},
+		},
+		{
+			name: "error stops",
+			states: func() []Fn {
+				return []Fn{steps("a", 2, ErrorEnd(errFailed)), steps("b", 1, End)}
+			},
+			wantLog: []string{"a", "a"},
+			wantErr: errFailed,
+		},
+		{
+			name: "then",
+			states: func() []Fn {
+				return []Fn{Then(steps("a", 2, End), steps("b", 1, End))}
+			},
+			wantLog: []string{"a", "a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log = nil
+			if err := Run(context.Background(), Sequence(tt.states()...)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Sequence() error = %v, wanted %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(log, tt.wantLog) {
+				t.Errorf("Sequence() executed %v, wanted %v", log, tt.wantLog)
+			}
+		})
+	}
+}
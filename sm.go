@@ -40,45 +40,44 @@ func filterEndStates(states []Fn) []Fn {
 // until it's reduced to a single End, or ErrorEnd state, when it stops and
 // returns the corresponding error.
 func Run(ctx context.Context, states ...Fn) error {
-	return run(ctx, aggStates(batchExec, states...))
+	return RunWithOptions(ctx, Options{}, states...)
 }
 
 // RunParallel executes the received states machine in a loop in parallel fashion
 // until it's reduced to a single End, or ErrorEnd state, when it stops and
 // returns the corresponding error.
 func RunParallel(ctx context.Context, states ...Fn) error {
-	return run(ctx, aggStates(parallelExec, states...))
+	return RunWithOptions(ctx, Options{Parallel: true}, states...)
 }
 
-func run(ctx context.Context, state Fn) error {
-	if IsEnd(state) {
-		return nil
-	}
-	var cancel context.CancelCauseFunc
-	var err error
+// RunParallelN executes the received states machine in a loop in parallel fashion, like
+// RunParallel does, but it runs at most "n" of the states at the same time.
+func RunParallelN(ctx context.Context, n int, states ...Fn) error {
+	return RunWithOptions(ctx, Options{Parallel: true, MaxParallel: n}, states...)
+}
 
-	ctx, cancel = context.WithCancelCause(ctx)
-	ctx = context.WithValue(ctx, __start, state)
-	if cancel != nil {
-		ctx = context.WithValue(ctx, __cancel, cancel)
-	}
+// Options configures the execution of a state machine started with RunWithOptions.
+type Options struct {
+	// Parallel executes the received states in parallel fashion, like RunParallel does.
+	Parallel bool
+	// MaxParallel limits the number of states executed at the same time when Parallel is set.
+	// If it's not positive, there is no limit.
+	MaxParallel int
+	// Observer, if set, gets notified about the progress of the state machine.
+	Observer Observer
+	// RecoverPanics converts the panics of any state in the machine, including the ones
+	// executed in separate goroutines, into an ErrorEnd state carrying a *PanicError.
+	RecoverPanics bool
+}
 
+// RunWithOptions executes the received states machine in a loop, configured by the "opts" Options,
+// until it's reduced to a single End, or ErrorEnd state, when it stops and
+// returns the corresponding error.
+func RunWithOptions(ctx context.Context, opts Options, states ...Fn) error {
+	m := NewMachineWithOptions(opts, states...)
 	for {
-		select {
-		case <-ctx.Done():
-			if err = context.Cause(ctx); err != nil {
-				state = ErrorEnd(err)
-				break
-			}
-			state = End
-			break
-		default:
-			if next := state(ctx); !IsEnd(next) {
-				state = next
-				continue
-			}
+		if done, err := m.Step(ctx); done {
+			return err
 		}
-		break
 	}
-	return context.Cause(ctx)
 }
@@ -0,0 +1,186 @@
+// Package ssmtest provides helpers for testing state machines built with the ssm package.
+package ssmtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"git.sr.ht/~mariusor/ssm"
+)
+
+// FakeClock is a ssm.Clock whose time only changes when Advance or Set are called.
+//
+// It can be passed to the state machines using ssm.WithClock, which makes the time based
+// states deterministic, without the need to sleep in tests.
+type FakeClock struct {
+	m      sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	added  chan struct{}
+}
+
+var _ ssm.Clock = new(FakeClock)
+
+// NewFakeClock returns a FakeClock which starts at "now" time.Time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, added: make(chan struct{})}
+}
+
+// Now returns the current time of the FakeClock.
+func (c *FakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// AfterFunc returns a ssm.Timer which calls "f" in its own goroutine when the
+// FakeClock gets advanced past "d" time.Duration from now, or immediately if "d" is not positive.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) ssm.Timer {
+	return c.add(d, f, nil)
+}
+
+// NewTimer returns a ssm.Timer which sends the current time on its channel when the
+// FakeClock gets advanced past "d" time.Duration from now, or immediately if "d" is not positive.
+func (c *FakeClock) NewTimer(d time.Duration) ssm.Timer {
+	return c.add(d, nil, make(chan time.Time, 1))
+}
+
+// Advance moves the time of the FakeClock forward by "d" time.Duration, and fires all the timers
+// that expire in the meantime, in the order of their expiration.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the time of the FakeClock to "t" time.Time, and fires all the timers
+// that expire in the meantime, in the order of their expiration.
+func (c *FakeClock) Set(t time.Time) {
+	c.m.Lock()
+	expired := make([]*fakeTimer, 0)
+	pending := c.timers[:0]
+	for _, ft := range c.timers {
+		if !ft.when.After(t) {
+			expired = append(expired, ft)
+		} else {
+			pending = append(pending, ft)
+		}
+	}
+	c.timers = pending
+	c.now = t
+	c.m.Unlock()
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].when.Before(expired[j].when)
+	})
+	for _, ft := range expired {
+		ft.fire(t)
+	}
+}
+
+// Timers returns the number of timers waiting to be fired.
+func (c *FakeClock) Timers() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until there are at least "n" timers waiting to be fired.
+//
+// It is useful for synchronizing a test with a state running in a different goroutine,
+// before advancing the FakeClock.
+func (c *FakeClock) WaitForTimers(n int) {
+	for {
+		c.m.Lock()
+		cnt := len(c.timers)
+		added := c.added
+		c.m.Unlock()
+		if cnt >= n {
+			return
+		}
+		<-added
+	}
+}
+
+func (c *FakeClock) add(d time.Duration, f func(), ch chan time.Time) *fakeTimer {
+	ft := &fakeTimer{c: c, fn: f, ch: ch}
+
+	c.m.Lock()
+	now := c.now
+	ft.when = now.Add(d)
+	expired := !ft.when.After(now)
+	if !expired {
+		c.schedule(ft)
+	}
+	c.m.Unlock()
+
+	// NOTE(marius): like the timers of the time package, the ones which are already expired fire immediately.
+	if expired {
+		ft.fire(now)
+	}
+	return ft
+}
+
+// schedule adds the "ft" timer to the pending ones and wakes up WaitForTimers calls.
+// It must be called with the lock held.
+func (c *FakeClock) schedule(ft *fakeTimer) {
+	c.timers = append(c.timers, ft)
+	close(c.added)
+	c.added = make(chan struct{})
+}
+
+// remove removes the "ft" timer from the pending ones, and returns if it was found.
+// It must be called with the lock held.
+func (c *FakeClock) remove(ft *fakeTimer) bool {
+	for i, t := range c.timers {
+		if t == ft {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	c    *FakeClock
+	when time.Time
+	fn   func()
+	ch   chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.m.Lock()
+	defer t.c.m.Unlock()
+	return t.c.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.m.Lock()
+	now := t.c.now
+	active := t.c.remove(t)
+	t.when = now.Add(d)
+	expired := !t.when.After(now)
+	if !expired {
+		t.c.schedule(t)
+	}
+	t.c.m.Unlock()
+
+	if expired {
+		t.fire(now)
+	}
+	return active
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.fn != nil {
+		go t.fn()
+		return
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
@@ -0,0 +1,342 @@
+package ssmtest
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/ssm"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClock_Advance(t *testing.T) {
+	c := NewFakeClock(epoch)
+
+	fired := make(chan time.Duration, 3)
+	for _, d := range []time.Duration{3 * time.Second, time.Second, 2 * time.Second} {
+		d := d
+		c.AfterFunc(d, func() { fired <- d })
+	}
+	timer := c.NewTimer(time.Second)
+
+	c.Advance(500 * time.Millisecond)
+	if got := c.Timers(); got != 4 {
+		t.Errorf("Timers() = %d, want %d", got, 4)
+	}
+
+	c.Advance(2 * time.Second)
+	if got := c.Now(); !got.Equal(epoch.Add(2500 * time.Millisecond)) {
+		t.Errorf("Now() = %s, want %s", got, epoch.Add(2500*time.Millisecond))
+	}
+	if got := c.Timers(); got != 1 {
+		t.Errorf("Timers() = %d, want %d", got, 1)
+	}
+	select {
+	case <-timer.C():
+	default:
+		t.Errorf("NewTimer() did not fire")
+	}
+	for i := 0; i < 2; i++ {
+		if d := <-fired; d > 2*time.Second {
+			t.Errorf("AfterFunc() fired timer of %s before expiring", d)
+		}
+	}
+}
+
+func TestFakeClock_Stop(t *testing.T) {
+	c := NewFakeClock(epoch)
+
+	timer := c.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Errorf("Stop() = false for active timer")
+	}
+	if timer.Stop() {
+		t.Errorf("Stop() = true for stopped timer")
+	}
+	c.Advance(time.Second)
+	select {
+	case <-timer.C():
+		t.Errorf("stopped timer fired")
+	default:
+	}
+	if timer.Reset(time.Second) {
+		t.Errorf("Reset() = true for stopped timer")
+	}
+	c.Advance(time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Errorf("Reset() timer did not fire")
+	}
+}
+
+func TestFakeClock_expired(t *testing.T) {
+	c := NewFakeClock(epoch)
+
+	fired := make(chan struct{})
+	c.AfterFunc(0, func() { close(fired) })
+	timer := c.NewTimer(-time.Second)
+
+	if got := c.Timers(); got != 0 {
+		t.Errorf("Timers() = %d, want %d", got, 0)
+	}
+	select {
+	case <-timer.C():
+	default:
+		t.Errorf("NewTimer() did not fire immediately")
+	}
+	<-fired
+
+	timer.Reset(0)
+	select {
+	case <-timer.C():
+	default:
+		t.Errorf("Reset() timer did not fire immediately")
+	}
+}
+
+func TestAfterZeroWithFakeClock(t *testing.T) {
+	ctx := ssm.WithClock(context.Background(), NewFakeClock(epoch))
+
+	executed := false
+	st := ssm.After(0, func(_ context.Context) ssm.Fn {
+		executed = true
+		return ssm.End
+	})
+	if err := ssm.Run(ctx, st); err != nil {
+		t.Errorf("Run() error = %s", err)
+	}
+	if !executed {
+		t.Errorf("After() did not execute the state")
+	}
+}
+
+func TestAfterWithFakeClock(t *testing.T) {
+	c := NewFakeClock(epoch)
+	ctx := ssm.WithClock(context.Background(), c)
+
+	var executedAt time.Time
+	st := ssm.After(time.Hour, func(ctx context.Context) ssm.Fn {
+		executedAt = ssm.ClockFrom(ctx).Now()
+		return ssm.End
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- ssm.Run(ctx, st)
+	}()
+
+	c.WaitForTimers(1)
+	c.Advance(time.Hour)
+
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %s", err)
+	}
+	if !executedAt.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("After() executed at %s, want %s", executedAt, epoch.Add(time.Hour))
+	}
+}
+
+func TestTimeoutWithFakeClock(t *testing.T) {
+	c := NewFakeClock(epoch)
+	ctx := ssm.WithClock(context.Background(), c)
+
+	st := ssm.Timeout(time.Minute, func(ctx context.Context) ssm.Fn {
+		<-ctx.Done()
+		return ssm.ErrorEnd(errors.New("canceled"))
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- ssm.Run(ctx, st)
+	}()
+
+	c.WaitForTimers(1)
+	c.Advance(time.Minute)
+
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want %s", err, context.DeadlineExceeded)
+	}
+}
+
+func TestHedgeWithFakeClock(t *testing.T) {
+	// mockLatency returns a state whose executions take the durations in "latencies", in order,
+	// and records how many times it was started and canceled.
+	mockLatency := func(started *atomic.Int32, canceled chan struct{}, latencies ...time.Duration) ssm.Fn {
+		return func(ctx context.Context) ssm.Fn {
+			i := started.Add(1) - 1
+			timer := ssm.ClockFrom(ctx).NewTimer(latencies[i])
+			defer timer.Stop()
+			select {
+			case <-timer.C():
+				return ssm.End
+			case <-ctx.Done():
+				canceled <- struct{}{}
+				return ssm.ErrorEnd(ctx.Err())
+			}
+		}
+	}
+
+	// step waits for "timers" timers to be pending, and then advances the clock by "advance".
+	type step struct {
+		timers  int
+		advance time.Duration
+	}
+	tests := []struct {
+		name         string
+		delay        time.Duration
+		maxHedges    int
+		latencies    []time.Duration
+		steps        []step
+		wantStarted  int32
+		wantCanceled int
+	}{
+		{
+			name:        "no hedges",
+			delay:       time.Millisecond,
+			maxHedges:   -1,
+			latencies:   []time.Duration{20 * time.Millisecond},
+			steps:       []step{{timers: 1, advance: 20 * time.Millisecond}},
+			wantStarted: 1,
+		},
+		{
+			name:        "fast enough",
+			delay:       time.Second,
+			maxHedges:   2,
+			latencies:   []time.Duration{time.Millisecond, time.Minute, time.Minute},
+			steps:       []step{{timers: 3, advance: time.Millisecond}},
+			wantStarted: 1,
+		},
+		{
+			name:      "hedged",
+			delay:     10 * time.Millisecond,
+			maxHedges: 1,
+			latencies: []time.Duration{time.Minute, time.Millisecond},
+			steps: []step{
+				{timers: 2, advance: 10 * time.Millisecond},
+				{timers: 2, advance: time.Millisecond},
+			},
+			wantStarted:  2,
+			wantCanceled: 1,
+		},
+		{
+			name:      "all hedges",
+			delay:     10 * time.Millisecond,
+			maxHedges: 2,
+			latencies: []time.Duration{time.Minute, time.Minute, time.Millisecond},
+			steps: []step{
+				{timers: 3, advance: 10 * time.Millisecond},
+				{timers: 3, advance: 10 * time.Millisecond},
+				{timers: 3, advance: time.Millisecond},
+			},
+			wantStarted:  3,
+			wantCanceled: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFakeClock(epoch)
+			ctx := ssm.WithClock(context.Background(), c)
+
+			started, canceled := atomic.Int32{}, make(chan struct{}, len(tt.latencies))
+			fn := ssm.Hedge(tt.delay, tt.maxHedges, mockLatency(&started, canceled, tt.latencies...))
+
+			done := make(chan error)
+			go func() {
+				done <- ssm.Run(ctx, fn)
+			}()
+			for _, s := range tt.steps {
+				c.WaitForTimers(s.timers)
+				c.Advance(s.advance)
+			}
+
+			if err := <-done; err != nil {
+				t.Errorf("Hedge() error = %v", err)
+			}
+			if got := started.Load(); got != tt.wantStarted {
+				t.Errorf("Hedge() started %d copies, wanted %d", got, tt.wantStarted)
+			}
+			for i := 0; i < tt.wantCanceled; i++ {
+				<-canceled
+			}
+		})
+	}
+}
+
+func TestHedgeStartsWithFakeClock(t *testing.T) {
+	ctx := ssm.WithClock(context.Background(), NewFakeClock(epoch))
+
+	ran := false
+	fn := ssm.Hedge(time.Second, 1, func(_ context.Context) ssm.Fn {
+		ran = true
+		return ssm.End
+	})
+	if err := ssm.Run(ctx, fn); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if !ran {
+		t.Errorf("Hedge() did not execute the state without advancing the clock")
+	}
+}
+
+func TestRateLimitWithFakeClock(t *testing.T) {
+	c := NewFakeClock(epoch)
+	ctx := ssm.WithClock(context.Background(), c)
+
+	ran := make(chan time.Time, 3)
+	inc := func(ctx context.Context) ssm.Fn {
+		ran <- ssm.ClockFrom(ctx).Now()
+		return ssm.End
+	}
+
+	t.Run("sequential", func(t *testing.T) {
+		st := ssm.RateLimitWithStrategy(ssm.TokenBucket(10, 1), inc)
+		if err := ssm.Run(ctx, st); err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+		start := <-ran
+
+		done := make(chan error)
+		go func() {
+			done <- ssm.Run(ctx, st)
+		}()
+		c.WaitForTimers(1)
+		c.Advance(100 * time.Millisecond)
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+		if got := (<-ran).Sub(start); got != 100*time.Millisecond {
+			t.Errorf("RateLimitWithStrategy() executed after %s, wanted %s", got, 100*time.Millisecond)
+		}
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		limit := ssm.TokenBucket(10, 1)
+		start := c.Now()
+
+		done := make(chan error)
+		go func() {
+			done <- ssm.RunParallel(ctx,
+				ssm.RateLimitWithStrategy(limit, inc),
+				ssm.RateLimitWithStrategy(limit, inc),
+				ssm.RateLimitWithStrategy(limit, inc),
+			)
+		}()
+		c.WaitForTimers(2)
+		for _, d := range []time.Duration{0, 100 * time.Millisecond} {
+			if got := (<-ran).Sub(start); got != d {
+				t.Errorf("RateLimitWithStrategy() executed after %s, wanted %s", got, d)
+			}
+			c.Advance(100 * time.Millisecond)
+		}
+		if got := (<-ran).Sub(start); got != 200*time.Millisecond {
+			t.Errorf("RateLimitWithStrategy() executed after %s, wanted %s", got, 200*time.Millisecond)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("RunParallel() error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package ssm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CounterStore is a storage for named integer counters, which can be shared by multiple processes,
+// so the replicas of a service can use the same rate limit and circuit breaker counters.
+//
+// The counters that don't exist, or that expired, have the value 0.
+// The MemoryStore and the FileStore are the implementations provided by this package, but any
+// backend which supports atomic increments, like Redis, can be plugged in.
+type CounterStore interface {
+	// Incr adds "delta" to the counter of "key" and returns its new value.
+	// When the counter gets created, it expires after "ttl" time.Duration, or never if "ttl" is not positive.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Get returns the value of the counter of "key".
+	Get(ctx context.Context, key string) (int64, error)
+	// CompareAndSet sets the counter of "key" to "new", if its value is "old", and reports if it was set.
+	// The counter expires after "ttl" time.Duration, or never if "ttl" is not positive.
+	CompareAndSet(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error)
+}
+
+type counter struct {
+	Value   int64     `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// counters implements the operations of a CounterStore over a map, with the "now" time
+// used for checking the expiration of the counters.
+type counters map[string]counter
+
+func (c counter) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
+}
+
+func (c counters) get(now time.Time, key string) int64 {
+	cnt, ok := c[key]
+	if !ok {
+		return 0
+	}
+	if cnt.expired(now) {
+		delete(c, key)
+		return 0
+	}
+	return cnt.Value
+}
+
+func (c counters) set(now time.Time, key string, value int64, ttl time.Duration) {
+	cnt := counter{Value: value}
+	if ttl > 0 {
+		cnt.Expires = now.Add(ttl)
+	}
+	c[key] = cnt
+}
+
+func (c counters) incr(now time.Time, key string, delta int64, ttl time.Duration) int64 {
+	cnt, ok := c[key]
+	if !ok || cnt.expired(now) {
+		c.set(now, key, delta, ttl)
+		return delta
+	}
+	cnt.Value += delta
+	c[key] = cnt
+	return cnt.Value
+}
+
+func (c counters) compareAndSet(now time.Time, key string, old, new int64, ttl time.Duration) bool {
+	if c.get(now, key) != old {
+		return false
+	}
+	c.set(now, key, new, ttl)
+	return true
+}
+
+// MemoryStore is a CounterStore which keeps the counters in memory.
+// The expiration of the counters is checked using the Clock found in the context.
+//
+// It is safe for concurrent use, but it can't be shared between processes.
+type MemoryStore struct {
+	m sync.Mutex
+	c counters
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{c: make(counters)}
+}
+
+func (s *MemoryStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	now := ClockFrom(ctx).Now()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.c.incr(now, key, delta, ttl), nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (int64, error) {
+	now := ClockFrom(ctx).Now()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.c.get(now, key), nil
+}
+
+func (s *MemoryStore) CompareAndSet(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error) {
+	now := ClockFrom(ctx).Now()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.c.compareAndSet(now, key, old, new, ttl), nil
+}
+
+// FileStore is a CounterStore which keeps the counters in a JSON file, which is read and
+// written back for every operation.
+// The expiration of the counters is checked using the Clock found in the context.
+//
+// It is safe for concurrent use from the same process, and it is meant to be used for tests,
+// as it doesn't lock the file against other processes.
+type FileStore struct {
+	m    sync.Mutex
+	path string
+}
+
+// NewFileStore creates a FileStore which saves the counters to the file at "path".
+// The file gets created on the first modification, if it doesn't exist.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var v int64
+	err := s.update(func(c counters) bool {
+		v = c.incr(ClockFrom(ctx).Now(), key, delta, ttl)
+		return true
+	})
+	return v, err
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (int64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	c, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	return c.get(ClockFrom(ctx).Now(), key), nil
+}
+
+func (s *FileStore) CompareAndSet(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error) {
+	var set bool
+	err := s.update(func(c counters) bool {
+		set = c.compareAndSet(ClockFrom(ctx).Now(), key, old, new, ttl)
+		return set
+	})
+	return set, err
+}
+
+// update loads the counters from the file, applies "fn" to them, and saves them back if "fn" returns true.
+func (s *FileStore) update(fn func(counters) bool) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	c, err := s.load()
+	if err != nil {
+		return err
+	}
+	if !fn(c) {
+		return nil
+	}
+	return s.save(c)
+}
+
+func (s *FileStore) load() (counters, error) {
+	c := make(counters)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return c, nil
+	}
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// save writes the counters to a temporary file, which then replaces the store's file,
+// so readers never find it partially written.
+func (s *FileStore) save(c counters) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,191 @@
+package ssm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounterStore(t *testing.T) {
+	type op struct {
+		advance time.Duration
+		do      func(ctx context.Context, s CounterStore) (int64, error)
+		want    int64
+	}
+	incr := func(delta int64, ttl time.Duration) func(context.Context, CounterStore) (int64, error) {
+		return func(ctx context.Context, s CounterStore) (int64, error) {
+			return s.Incr(ctx, "key", delta, ttl)
+		}
+	}
+	get := func(ctx context.Context, s CounterStore) (int64, error) {
+		return s.Get(ctx, "key")
+	}
+	cas := func(old, new int64) func(context.Context, CounterStore) (int64, error) {
+		return func(ctx context.Context, s CounterStore) (int64, error) {
+			ok, err := s.CompareAndSet(ctx, "key", old, new, 0)
+			if ok {
+				return 1, err
+			}
+			return 0, err
+		}
+	}
+	tests := []struct {
+		name string
+		ops  []op
+	}{
+		{
+			name: "empty",
+			ops:  []op{{do: get, want: 0}},
+		},
+		{
+			name: "increment",
+			ops: []op{
+				{do: incr(1, 0), want: 1},
+				{do: incr(2, 0), want: 3},
+				{do: incr(-1, 0), want: 2},
+				{do: get, want: 2},
+			},
+		},
+		{
+			name: "expired",
+			ops: []op{
+				{do: incr(1, time.Second), want: 1},
+				{do: incr(1, time.Second), want: 2},
+				{advance: time.Second, do: get, want: 0},
+				{do: incr(1, time.Second), want: 1},
+			},
+		},
+		{
+			name: "ttl from creation",
+			ops: []op{
+				{do: incr(1, time.Second), want: 1},
+				{advance: 900 * time.Millisecond, do: incr(1, time.Second), want: 2},
+				{advance: 100 * time.Millisecond, do: get, want: 0},
+			},
+		},
+		{
+			name: "compare and set",
+			ops: []op{
+				{do: cas(1, 5), want: 0},
+				{do: cas(0, 5), want: 1},
+				{do: get, want: 5},
+				{do: cas(4, 0), want: 0},
+				{do: cas(5, 0), want: 1},
+				{do: get, want: 0},
+			},
+		},
+	}
+	stores := map[string]func(t *testing.T) CounterStore{
+		"memory": func(t *testing.T) CounterStore { return NewMemoryStore() },
+		"file": func(t *testing.T) CounterStore {
+			return NewFileStore(filepath.Join(t.TempDir(), "counters.json"))
+		},
+	}
+	for storeName, newStore := range stores {
+		for _, tt := range tests {
+			t.Run(storeName+": "+tt.name, func(t *testing.T) {
+				c := newTestClock()
+				ctx := WithClock(context.Background(), c)
+				s := newStore(t)
+				for i, o := range tt.ops {
+					c.advance(o.advance)
+					got, err := o.do(ctx, s)
+					if err != nil {
+						t.Errorf("op %d error = %v", i, err)
+					}
+					if got != o.want {
+						t.Errorf("op %d = %d, wanted %d", i, got, o.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFileStore_shared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	ctx := context.Background()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = NewFileStore(path).Incr(ctx, "key", 1, 0)
+		}()
+	}
+	wg.Wait()
+
+	// NOTE(marius): separate FileStore instances are not synchronized, so we only check that the file remains valid.
+	if got, err := NewFileStore(path).Get(ctx, "key"); err != nil || got < 1 {
+		t.Errorf("Get() = %d, %v, wanted a positive count", got, err)
+	}
+
+	s := NewFileStore(path)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = s.Incr(ctx, "other", 1, 0)
+		}()
+	}
+	wg.Wait()
+	if got, err := NewFileStore(path).Get(ctx, "other"); err != nil || got != 10 {
+		t.Errorf("Get() = %d, %v, wanted %d", got, err, 10)
+	}
+}
+
+func TestFileStore_invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	if _, err := NewFileStore(path).Incr(context.Background(), "key", 1, 0); err == nil {
+		t.Errorf("Incr() with invalid file should have returned an error")
+	}
+}
+
+func TestSharedFixedWindow(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	// NOTE(marius): the two strategies represent different replicas, which share the same window.
+	replicas := []LimitStrategy{
+		SharedFixedWindow(store, "window", 2, 10*time.Millisecond),
+		SharedFixedWindow(store, "window", 2, 10*time.Millisecond),
+	}
+	want := []bool{false, true, false, true}
+	for i, w := range want {
+		stalled, delay := replicas[i%2].Limit(ctx)
+		if stalled != w {
+			t.Errorf("iter %d invalid status %t, wanted %t", i, stalled, w)
+		}
+		if stalled && delay != 5*time.Millisecond {
+			t.Errorf("iter %d invalid delay %s, wanted %s", i, delay, 5*time.Millisecond)
+		}
+	}
+}
+
+func TestSharedMaxTriesTrip(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	replicas := []TripStrategy{
+		SharedMaxTriesTrip(store, "tries", 3),
+		SharedMaxTriesTrip(store, "tries", 3),
+	}
+	want := []bool{false, false, true, true}
+	for i, w := range want {
+		if got := replicas[i%2].Failure(ctx); got != w {
+			t.Errorf("iter %d Failure() = %t, wanted %t", i, got, w)
+		}
+	}
+
+	replicas[0].(resetter).Reset()
+	if got := replicas[1].Failure(ctx); got {
+		t.Errorf("Failure() after Reset() = %t, wanted %t", got, false)
+	}
+}
@@ -10,19 +10,20 @@ import (
 //
 // If the timeout is reached, the execution is canceled and an ErrorEnd state wrapping the
 // context.DeadlineExceeded error is returned.
+//
+// The timeout is measured using the Clock found in the context.
 func Timeout(max time.Duration, state Fn) Fn {
 	if IsEnd(state) {
 		return state
 	}
 
-	var cancel func()
 	return func(ctx context.Context) Fn {
-		ctx, cancel = context.WithTimeout(ctx, max)
+		ctx, cancel := withTimeout(ctx, max)
 		defer cancel()
 
-		next := make(chan Fn)
+		next := make(chan Fn, 1)
 		go func() {
-			next <- state(ctx)
+			next <- exec(ctx, state)
 		}()
 
 		select {
@@ -40,5 +41,5 @@ func Timeout(max time.Duration, state Fn) Fn {
 
 // TimeoutExceeded is an error state that is used when a Timeout is reached.
 func TimeoutExceeded() Fn {
-	return errState{context.DeadlineExceeded}.stop
+	return errState{error: context.DeadlineExceeded}.stop
 }